@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config"
+)
+
+func runConfig(args []string) int {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: toolkit config check -f config.yml [-probe]")
+		return 2
+	}
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	file := fs.String("f", "", "config file, search ../conf, ./conf, ./ when empty")
+	envPrefix := fs.String("env", "", "environment variable prefix")
+	probe := fs.Bool("probe", false, "ping mysql/redis sections and check log paths are writable")
+	timeout := fs.Duration("timeout", 10*time.Second, "overall probe timeout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := config.Check(ctx, &conf{}, *file, *envPrefix, *probe)
+	report.WriteTo(os.Stdout)
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
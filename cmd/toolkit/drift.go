@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/gen"
+)
+
+const driftUsage = "drift -f config.yml -handle db -dir ./model [-pkg model] [-tables a,b] [-json]"
+
+// 对比 gen 生成的代码与线上表结构, 存在不一致时返回 1
+func runDrift(args []string) int {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	file := fs.String("f", "", "config file, search ../conf, ./conf, ./ when empty")
+	envPrefix := fs.String("env", "", "environment variable prefix")
+	handle := fs.String("handle", "", "mysql section name")
+	dir := fs.String("dir", ".", "generated code directory")
+	pkg := fs.String("pkg", "", "package name, default directory name")
+	tables := fs.String("tables", "", "comma separated tables, all tables when empty")
+	jsonTag := fs.Bool("json", false, "generated with json tags")
+	timeout := fs.Duration("timeout", time.Minute, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *handle == "" {
+		fmt.Fprintln(os.Stderr, "usage: toolkit "+driftUsage)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mysql, err := initHandle(ctx, *file, *envPrefix, *handle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer mysql.Close()
+
+	opt := gen.Options{Handle: *handle, Dir: *dir, Package: *pkg, JSONTag: *jsonTag}
+	if *tables != "" {
+		for _, t := range strings.Split(*tables, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opt.Tables = append(opt.Tables, t)
+			}
+		}
+	}
+	files, err := gen.Diff(ctx, opt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(os.Stderr, "%d files out of date, run toolkit gen to regenerate\n", len(files))
+		return 1
+	}
+	fmt.Println("schema ok")
+	return 0
+}
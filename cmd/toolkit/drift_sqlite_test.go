@@ -0,0 +1,67 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRunDrift_sqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toolkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+	conf := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(conf, []byte("mysql:\n  lite:\n    driver: sqlite3\n    db: "+path+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exec := func(stmt string) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, amount INTEGER NOT NULL)")
+
+	model := filepath.Join(dir, "model")
+	base := []string{"-f", conf, "-handle", "lite"}
+	if code := runGen(append(base, "-out", model)); code != 0 {
+		t.Fatalf("runGen() = %d", code)
+	}
+	drift := func() int {
+		return runDrift(append(base, "-dir", model))
+	}
+	if code := drift(); code != 0 {
+		t.Errorf("runDrift() after gen = %d, want 0", code)
+	}
+
+	exec("ALTER TABLE users ADD COLUMN age INTEGER")
+	if code := drift(); code != 1 {
+		t.Errorf("runDrift() after add column = %d, want 1", code)
+	}
+	if code := runDrift(append(base, "-dir", model, "-tables", "orders")); code != 0 {
+		t.Errorf("runDrift(-tables orders) = %d, want 0", code)
+	}
+
+	if code := runGen(append(base, "-out", model)); code != 0 {
+		t.Fatalf("runGen() = %d", code)
+	}
+	exec("DROP TABLE orders")
+	if code := drift(); code != 1 {
+		t.Errorf("runDrift() after drop table = %d, want 1", code)
+	}
+}
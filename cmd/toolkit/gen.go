@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/gen"
+)
+
+const genUsage = "gen -f config.yml -handle db -out ./model [-pkg model] [-tables a,b] [-json]"
+
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	file := fs.String("f", "", "config file, search ../conf, ./conf, ./ when empty")
+	envPrefix := fs.String("env", "", "environment variable prefix")
+	handle := fs.String("handle", "", "mysql section name")
+	out := fs.String("out", ".", "output directory")
+	pkg := fs.String("pkg", "", "package name, default output directory name")
+	tables := fs.String("tables", "", "comma separated tables, all tables when empty")
+	jsonTag := fs.Bool("json", false, "add json tags")
+	timeout := fs.Duration("timeout", time.Minute, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *handle == "" {
+		fmt.Fprintln(os.Stderr, "usage: toolkit "+genUsage)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mysql, err := initHandle(ctx, *file, *envPrefix, *handle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer mysql.Close()
+
+	opt := gen.Options{Handle: *handle, Dir: *out, Package: *pkg, JSONTag: *jsonTag}
+	if *tables != "" {
+		for _, t := range strings.Split(*tables, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opt.Tables = append(opt.Tables, t)
+			}
+		}
+	}
+	files, err := gen.Generate(ctx, opt)
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+// toolkit 命令行工具
+//
+//	toolkit config check -f config.yml [-probe]
+//	toolkit migrate -f config.yml -handle db -dir migrations up|down|status
+//	toolkit gen -f config.yml -handle db -out ./model
+//	toolkit drift -f config.yml -handle db -dir ./model
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/zhouchang2017/toolkit/config"
+	"github.com/zhouchang2017/toolkit/config/logconfig"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+)
+
+// 与应用入口保持一致的配置结构
+type conf struct {
+	Logs  *logconfig.Configs
+	Mysql *mysqlconfig.Configs
+	Redis *redisconfig.Configs
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{name: "config", usage: "config check -f config.yml [-probe]", run: runConfig},
+	{name: "migrate", usage: migrateUsage, run: runMigrate},
+	{name: "gen", usage: genUsage, run: runGen},
+	{name: "drift", usage: driftUsage, run: runDrift},
+}
+
+// 读取配置并仅初始化指定的 mysql 连接
+func initHandle(ctx context.Context, file string, envPrefix string, handle string) (*mysqlconfig.Configs, error) {
+	c := &conf{}
+	if err := config.Load(ctx, c, file, envPrefix); err != nil {
+		return nil, err
+	}
+	if c.Mysql == nil {
+		return nil, fmt.Errorf("mysql [%s] not found", handle)
+	}
+	section, ok := (*c.Mysql)[handle]
+	if !ok {
+		return nil, fmt.Errorf("mysql [%s] not found", handle)
+	}
+	section.Mode = mysqlconfig.ModeStrict
+	mysql := &mysqlconfig.Configs{handle: section}
+	if err := mysql.Init(); err != nil {
+		return nil, err
+	}
+	return mysql, nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: toolkit <command> [arguments]")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  toolkit %s\n", cmd.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	usage()
+	os.Exit(2)
+}
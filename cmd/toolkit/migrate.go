@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/migrate"
+)
+
+const migrateUsage = "migrate -f config.yml -handle db -dir migrations [-dry-run] [-to VERSION] [-steps N] up|down|status"
+
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	file := fs.String("f", "", "config file, search ../conf, ./conf, ./ when empty")
+	envPrefix := fs.String("env", "", "environment variable prefix")
+	handle := fs.String("handle", "", "mysql section name")
+	dir := fs.String("dir", "migrations", "migration files directory")
+	table := fs.String("table", "", "bookkeeping table, default schema_migrations")
+	dryRun := fs.Bool("dry-run", false, "print pending migrations without executing")
+	to := fs.Int64("to", -1, "target version, up: latest when not set, down: roll back migrations after this version, 0 rolls back all")
+	steps := fs.Int("steps", 0, "down: number of migrations to roll back, default 1 when -to is not set")
+	ignoreDrift := fs.Bool("ignore-drift", false, "apply even if applied migration files were modified")
+	timeout := fs.Duration("timeout", 10*time.Minute, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *handle == "" || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: toolkit "+migrateUsage)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mysql, err := initHandle(ctx, *file, *envPrefix, *handle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer mysql.Close()
+
+	m := migrate.New(*handle, migrate.Options{
+		Dir:         *dir,
+		Table:       *table,
+		DryRun:      *dryRun,
+		IgnoreDrift: *ignoreDrift,
+	})
+
+	switch fs.Arg(0) {
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return printStatus(statuses)
+	case "up":
+		// Up 的目标版本为 0 时执行全部
+		target := *to
+		if target < 0 {
+			target = 0
+		}
+		return printPlan(m.Up(ctx, target))
+	case "down":
+		target := *to
+		if target < 0 {
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			target = downTarget(statuses, *steps)
+		}
+		return printPlan(m.Down(ctx, target))
+	}
+	fmt.Fprintln(os.Stderr, "usage: toolkit "+migrateUsage)
+	return 2
+}
+
+// 回滚最近 n 个迁移后的目标版本, n 不大于 0 时回滚 1 个
+func downTarget(statuses []migrate.Status, n int) int64 {
+	if n <= 0 {
+		n = 1
+	}
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		if n == 0 {
+			return statuses[i].Version
+		}
+		n--
+	}
+	return 0
+}
+
+func printPlan(migrations []*migrate.Migration, err error) int {
+	for _, mig := range migrations {
+		fmt.Printf("%d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(migrations) == 0 {
+		fmt.Println("nothing to migrate")
+	}
+	return 0
+}
+
+// 打印迁移状态, 存在漂移时返回 1
+func printStatus(statuses []migrate.Status) int {
+	code := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, st := range statuses {
+		status, appliedAt := "pending", ""
+		if st.Applied {
+			status, appliedAt = "applied", st.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case st.Missing:
+			status, code = "missing file", 1
+		case st.Drift:
+			status, code = "modified", 1
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+	}
+	w.Flush()
+	return code
+}
@@ -0,0 +1,83 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRunMigrate_sqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toolkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+	files := map[string]string{
+		"config.yml":                   "mysql:\n  lite:\n    driver: sqlite3\n    db: " + path + "\n",
+		"migrations/1_users.up.sql":    "CREATE TABLE users (id INT);",
+		"migrations/1_users.down.sql":  "DROP TABLE users;",
+		"migrations/2_orders.up.sql":   "CREATE TABLE orders (id INT);",
+		"migrations/2_orders.down.sql": "DROP TABLE orders;",
+		"migrations/3_items.up.sql":    "CREATE TABLE items (id INT);",
+		"migrations/3_items.down.sql":  "DROP TABLE items;",
+	}
+	if err := os.Mkdir(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	applied := func() []int64 {
+		rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		res := make([]int64, 0)
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, v)
+		}
+		return res
+	}
+
+	base := []string{"-f", filepath.Join(dir, "config.yml"), "-handle", "lite", "-dir", filepath.Join(dir, "migrations")}
+	tests := []struct {
+		name string
+		args []string
+		want []int64
+	}{
+		{"up", []string{"up"}, []int64{1, 2, 3}},
+		{"down one step", []string{"down"}, []int64{1, 2}},
+		{"down to 0", []string{"-to", "0", "down"}, []int64{}},
+		{"up to 2", []string{"-to", "2", "up"}, []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		args := append(append([]string(nil), base...), tt.args...)
+		if code := runMigrate(args); code != 0 {
+			t.Fatalf("%s: runMigrate() = %d", tt.name, code)
+		}
+		if got := applied(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: applied = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
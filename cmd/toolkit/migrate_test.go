@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/db/migrate"
+)
+
+func TestDownTarget(t *testing.T) {
+	statuses := []migrate.Status{
+		{Version: 1, Applied: true},
+		{Version: 2, Applied: true},
+		{Version: 3},
+		{Version: 5, Applied: true},
+	}
+	tests := []struct {
+		name string
+		n    int
+		want int64
+	}{
+		{"default", 0, 2},
+		{"last", 1, 2},
+		{"skip pending", 2, 1},
+		{"all", 3, 0},
+		{"more than applied", 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downTarget(statuses, tt.n); got != tt.want {
+				t.Errorf("downTarget(%d) = %d, want %d", tt.n, got, tt.want)
+			}
+		})
+	}
+	if got := downTarget(nil, 1); got != 0 {
+		t.Errorf("downTarget(nil) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	StageLoad     = "load"
+	StageValidate = "validate"
+	StageProbe    = "probe"
+)
+
+type CheckItem struct {
+	Stage   string
+	Section string
+	Name    string
+	Err     error
+	Cost    time.Duration
+}
+
+type CheckReport struct {
+	File  string
+	Items []CheckItem
+}
+
+func (r *CheckReport) add(item CheckItem) {
+	r.Items = append(r.Items, item)
+}
+
+// 所有检查项均通过
+func (r *CheckReport) Passed() bool {
+	for _, item := range r.Items {
+		if item.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// 输出检查报告
+func (r *CheckReport) WriteTo(w io.Writer) (int64, error) {
+	var buf strings.Builder
+	failed := 0
+	for _, item := range r.Items {
+		status := "PASS"
+		if item.Err != nil {
+			status = "FAIL"
+			failed++
+		}
+		target := item.Section
+		if item.Name != "" {
+			target += "." + item.Name
+		}
+		if target == "" {
+			target = r.File
+		}
+		fmt.Fprintf(&buf, "%s\t%-8s\t%s", status, item.Stage, target)
+		if cost := item.Cost.Round(time.Millisecond); cost > 0 {
+			fmt.Fprintf(&buf, "\t%s", cost)
+		}
+		if item.Err != nil {
+			fmt.Fprintf(&buf, "\t%s", item.Err.Error())
+		}
+		buf.WriteByte('\n')
+	}
+	if failed > 0 {
+		fmt.Fprintf(&buf, "FAIL %d/%d checks failed\n", failed, len(r.Items))
+	} else {
+		fmt.Fprintf(&buf, "OK %d checks passed\n", len(r.Items))
+	}
+	n, err := io.WriteString(w, buf.String())
+	return int64(n), err
+}
+
+// 执行完整的配置加载流程但不初始化各模块, probe 为 true 时探测各模块连通性
+// 检查项按配置结构体的字段顺序, 同一配置段的探测结果按名称排序
+func Check(ctx context.Context, config interface{}, configName string, envPrefix string, probe bool) *CheckReport {
+	if config == nil {
+		panic("config is nil")
+	}
+
+	c := Config{
+		Name: configName,
+	}
+	report := &CheckReport{File: configName}
+
+	start := time.Now()
+	err := c.readConfig(ctx, config, envPrefix)
+	if used := viper.ConfigFileUsed(); used != "" {
+		report.File = used
+	}
+	report.add(CheckItem{Stage: StageLoad, Err: err, Cost: time.Since(start)})
+	if err != nil {
+		return report
+	}
+
+	value := reflect.ValueOf(config)
+	if value.Type().Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		report.add(CheckItem{Stage: StageLoad, Err: errors.New("Pointer type required")})
+		return report
+	}
+	value = value.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		v := value.Field(i)
+		section := sectionName(value.Type().Field(i))
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			continue
+		}
+		f := v.Interface()
+		if cb, ok := f.(ValidateCallback); ok {
+			report.add(CheckItem{Stage: StageValidate, Section: section, Err: cb.Validate()})
+		}
+	}
+
+	if !probe || !report.Passed() {
+		return report
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		v := value.Field(i)
+		section := sectionName(value.Type().Field(i))
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			continue
+		}
+		f := v.Interface()
+		if cb, ok := f.(ProbeCallback); ok {
+			// 各模块按 map 遍历探测, 按名称排序使报告顺序稳定
+			results := cb.Probe(ctx)
+			sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+			for _, res := range results {
+				report.add(CheckItem{Stage: StageProbe, Section: section, Name: res.Name, Err: res.Err, Cost: res.Cost})
+			}
+		}
+	}
+
+	return report
+}
+
+// 配置段名称, 与 viper 解析规则保持一致
+func sectionName(field reflect.StructField) string {
+	if tag := field.Tag.Get("mapstructure"); tag != "" {
+		return strings.Split(tag, ",")[0]
+	}
+	return strings.ToLower(field.Name)
+}
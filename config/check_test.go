@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type probeConf struct {
+	Addr string
+}
+
+type probeConfigs map[string]*probeConf
+
+func (c *probeConfigs) Validate() error {
+	for name, conf := range *c {
+		if conf.Addr == "" {
+			return errors.New(name + " addr is required")
+		}
+	}
+	return nil
+}
+
+func (c *probeConfigs) Probe(ctx context.Context) []ProbeResult {
+	results := make([]ProbeResult, 0, len(*c))
+	for name, conf := range *c {
+		var err error
+		if conf.Addr == "down" {
+			err = errors.New("connection refused")
+		}
+		results = append(results, ProbeResult{Name: name, Err: err})
+	}
+	return results
+}
+
+type checkConf struct {
+	Cache *probeConfigs `mapstructure:"cache"`
+	Queue *probeConfigs
+}
+
+func writeConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		probe   bool
+		want    []string
+		passed  bool
+	}{
+		{
+			name:    "probe sorted by name",
+			content: "cache:\n  e: {addr: a}\n  b: {addr: down}\n  d: {addr: a}\n  a: {addr: a}\n  c: {addr: a}\nqueue:\n  z: {addr: a}\n",
+			probe:   true,
+			want: []string{
+				"PASS\tload", "PASS\tvalidate\tcache", "PASS\tvalidate\tqueue",
+				"PASS\tprobe   \tcache.a", "FAIL\tprobe   \tcache.b\tconnection refused", "PASS\tprobe   \tcache.c",
+				"PASS\tprobe   \tcache.d", "PASS\tprobe   \tcache.e", "PASS\tprobe   \tqueue.z",
+				"FAIL 1/9 checks failed",
+			},
+		},
+		{
+			name:    "validate failure skips probe",
+			content: "cache:\n  a: {addr: \"\"}\n",
+			probe:   true,
+			want:    []string{"PASS\tload", "FAIL\tvalidate\tcache\ta addr is required", "FAIL 1/2 checks failed"},
+		},
+		{
+			name:    "without probe",
+			content: "cache:\n  a: {addr: down}\n",
+			want:    []string{"PASS\tload", "PASS\tvalidate\tcache", "OK 2 checks passed"},
+			passed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, cleanup := writeConfig(t, tt.content)
+			defer cleanup()
+			// 多次执行, 排除 map 遍历顺序偶然一致
+			for i := 0; i < 5; i++ {
+				report := Check(context.Background(), &checkConf{}, file, "TOOLKIT_TEST_", tt.probe)
+				if report.Passed() != tt.passed {
+					t.Errorf("Passed() = %v, want %v", report.Passed(), tt.passed)
+				}
+				var buf strings.Builder
+				if _, err := report.WriteTo(&buf); err != nil {
+					t.Fatal(err)
+				}
+				lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+				if len(lines) != len(tt.want) {
+					t.Fatalf("report = %q, want %d lines", buf.String(), len(tt.want))
+				}
+				for j, want := range tt.want {
+					if !strings.HasPrefix(lines[j], want) {
+						t.Errorf("line %d = %q, want prefix %q", j, lines[j], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheck_loadError(t *testing.T) {
+	report := Check(context.Background(), &checkConf{}, filepath.Join(os.TempDir(), "toolkit-missing.yml"), "TOOLKIT_TEST_", true)
+	if report.Passed() || len(report.Items) != 1 || report.Items[0].Stage != StageLoad {
+		t.Errorf("Check() = %+v, want a single failed load item", report.Items)
+	}
+}
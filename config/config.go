@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"github.com/zhouchang2017/toolkit/log"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 )
 
 // 初始化
@@ -30,6 +32,22 @@ type OnCloseCallback interface {
 	Close() (err error)
 }
 
+// 配置校验
+type ValidateCallback interface {
+	Validate() (err error)
+}
+
+// 连通性探测
+type ProbeCallback interface {
+	Probe(ctx context.Context) (results []ProbeResult)
+}
+
+type ProbeResult struct {
+	Name string
+	Err  error
+	Cost time.Duration
+}
+
 type Config struct {
 	Name string
 }
@@ -55,6 +73,18 @@ func Init(ctx context.Context, config interface{}, configName string, envPrefix
 
 }
 
+// 仅解析配置, 不执行初始化回调也不监控文件变化, 用于命令行工具按需初始化
+func Load(ctx context.Context, config interface{}, configName string, envPrefix string) error {
+	if config == nil {
+		panic("config is nil")
+	}
+
+	c := Config{
+		Name: configName,
+	}
+	return c.readConfig(ctx, config, envPrefix)
+}
+
 func getInitDir() ([]string, error) {
 	var binDir string
 	ret := make([]string, 0)
@@ -99,6 +129,15 @@ func getInitDir() ([]string, error) {
 }
 
 func (c *Config) initConfig(ctx context.Context, config interface{}, envPrefix string) error {
+	if err := c.readConfig(ctx, config, envPrefix); err != nil {
+		return err
+	}
+
+	return LoadInitialCallbacks(config)
+}
+
+// 解析配置文件、include 及环境变量
+func (c *Config) readConfig(ctx context.Context, config interface{}, envPrefix string) error {
 	if c.Name != "" {
 		viper.SetConfigFile(c.Name) // 如果指定了配置文件，则解析指定的配置文件
 	} else {
@@ -161,11 +200,7 @@ func (c *Config) initConfig(ctx context.Context, config interface{}, envPrefix s
 		log.Logger.Info("skip include for [include] not found.")
 	}
 
-	if err := viper.Unmarshal(config); err != nil {
-		return err
-	}
-
-	return LoadInitialCallbacks(config)
+	return viper.Unmarshal(config)
 }
 
 func LoadInitialCallbacks(config interface{}) error {
@@ -207,6 +242,7 @@ func LoadOnCloseCallbacks(config interface{}) error {
 
 	value = value.Elem()
 
+	var firstErr error
 	for i := 0; i < value.NumField(); i++ {
 		v := value.Field(i)
 
@@ -215,17 +251,17 @@ func LoadOnCloseCallbacks(config interface{}) error {
 			log.Logger.Debugf("%s config not found, check if [%s] contains valid section [%s].", name, viper.ConfigFileUsed(), strings.ToLower(name))
 		}
 		f := v.Interface()
-		initCB, ok := f.(OnCloseCallback)
-		if ok {
-			err := initCB.Close()
-			if err != nil {
-				return err
+		// 某个配置段关闭失败时继续关闭其他配置段, 返回第一个错误
+		if closeCB, ok := f.(OnCloseCallback); ok {
+			if err := closeCB.Close(); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
 			}
-			continue
 		}
 	}
 
-	return nil
+	return firstErr
 }
 
 // 监控配置文件变化并热加载程序
@@ -233,7 +269,8 @@ func (c *Config) watchConfig(config interface{}) {
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		log.Logger.Infof("config file changed")
-		if err := viper.Unmarshal(config); err != nil {
+		// 清空原有配置, 使删除的配置段生效
+		if err := viper.Unmarshal(config, func(dc *mapstructure.DecoderConfig) { dc.ZeroFields = true }); err != nil {
 			log.Logger.Panic(err)
 		}
 		value := reflect.ValueOf(config)
@@ -0,0 +1,215 @@
+// 可轮换的连接密码, 来源为配置、文件或注册的 provider
+package credential
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultProviderRefresh = 5 * time.Minute
+	readTimeout            = 10 * time.Second
+)
+
+// 密码提供者, key 为配置段名称, 如 mysql.db1
+type Provider func(ctx context.Context, key string) (password string, err error)
+
+var (
+	providers  = map[string]Provider{}
+	providerMu sync.RWMutex
+)
+
+// 注册 provider, 配置中通过 password_provider 引用
+func RegisterProvider(name string, p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	providers[name] = p
+}
+
+func getProvider(name string) (Provider, bool) {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// 密码来源, 优先级 provider > file > password
+type Source struct {
+	// 配置段名称, 用于日志及 provider
+	Key      string
+	Password string
+	File     string
+	Provider string
+	// 重新读取的间隔, 文件来源同时监听文件变化, provider 来源默认 5m
+	Refresh time.Duration
+}
+
+// 是否需要轮换
+func (s Source) Dynamic() bool {
+	return s.File != "" || s.Provider != ""
+}
+
+func (s Source) Validate() error {
+	if s.Provider != "" {
+		if _, ok := getProvider(s.Provider); !ok {
+			return fmt.Errorf("password provider %q not registered", s.Provider)
+		}
+	}
+	if s.Refresh < 0 {
+		return fmt.Errorf("password_refresh must not be negative")
+	}
+	return nil
+}
+
+// 读取当前密码
+func (s Source) Read(ctx context.Context) (string, error) {
+	switch {
+	case s.Provider != "":
+		p, ok := getProvider(s.Provider)
+		if !ok {
+			return "", fmt.Errorf("password provider %q not registered", s.Provider)
+		}
+		return p(ctx, s.Key)
+	case s.File != "":
+		b, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return s.Password, nil
+}
+
+// 持有当前密码并在后台刷新
+type Credential struct {
+	source     Source
+	mu         sync.RWMutex
+	password   string
+	generation uint64
+	stop       chan struct{}
+	once       sync.Once
+}
+
+// 读取密码并开始刷新, 首次读取失败时返回错误
+func Watch(source Source) (*Credential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
+	defer cancel()
+	password, err := source.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("credential [%s] read err:%w", source.Key, err)
+	}
+	c := &Credential{source: source, password: password, stop: make(chan struct{})}
+	if source.Dynamic() {
+		go c.watch(c.watchFile())
+	}
+	return c, nil
+}
+
+func (c *Credential) Password() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.password
+}
+
+// 密码每次变化时递增, 用于判断连接使用的密码是否过期
+func (c *Credential) Generation() uint64 {
+	return atomic.LoadUint64(&c.generation)
+}
+
+func (c *Credential) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	return nil
+}
+
+// 立即重新读取密码, 读取失败时保留原密码
+func (c *Credential) Reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
+	defer cancel()
+	password, err := c.source.Read(ctx)
+	if err != nil {
+		log.Logger.Warnf("credential [%s] reload err:%s, keep the old password", c.source.Key, err.Error())
+		return
+	}
+	c.mu.Lock()
+	changed := password != c.password
+	c.password = password
+	c.mu.Unlock()
+	if changed {
+		atomic.AddUint64(&c.generation, 1)
+		log.Logger.Infof("credential [%s] rotated", c.source.Key)
+	}
+}
+
+// 监听密码文件所在目录, 兼容通过替换软链接更新的 secret 文件
+func (c *Credential) watchFile() *fsnotify.Watcher {
+	if c.source.Provider != "" || c.source.File == "" {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(c.source.File)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Logger.Warnf("credential [%s] watch file err:%s", c.source.Key, err.Error())
+		return nil
+	}
+	return watcher
+}
+
+func (c *Credential) watch(watcher *fsnotify.Watcher) {
+	refresh := c.source.Refresh
+	if refresh <= 0 && c.source.Provider != "" {
+		refresh = defaultProviderRefresh
+	}
+	var tick <-chan time.Time
+	if refresh > 0 {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watcher != nil {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+	if tick == nil && events == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-tick:
+			c.Reload()
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				c.Reload()
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Logger.Warnf("credential [%s] watch file err:%s", c.source.Key, err.Error())
+		}
+	}
+}
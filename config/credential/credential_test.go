@@ -0,0 +1,90 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSource_Read(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	RegisterProvider("test", func(ctx context.Context, key string) (string, error) {
+		if key != "mysql.db1" {
+			return "", errors.New("unknown key")
+		}
+		return "from-provider", nil
+	})
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr bool
+	}{
+		{"static", Source{Password: "static"}, "static", false},
+		{"file", Source{Password: "static", File: file}, "s3cret", false},
+		{"provider", Source{Key: "mysql.db1", File: file, Provider: "test"}, "from-provider", false},
+		{"missing file", Source{File: filepath.Join(dir, "missing")}, "", true},
+		{"unknown provider", Source{Provider: "missing"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := tt.source.Read(context.Background())
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: Read() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if err := (Source{Provider: "missing"}).Validate(); err == nil {
+		t.Error("Validate() unknown provider should fail")
+	}
+}
+
+func TestWatch_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Watch(Source{Key: "test", File: file})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer c.Close()
+	if c.Password() != "old" || c.Generation() != 0 {
+		t.Fatalf("Password() = %q, Generation() = %d", c.Password(), c.Generation())
+	}
+
+	if err := ioutil.WriteFile(file, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Password() != "new" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Password() != "new" || c.Generation() == 0 {
+		t.Errorf("Password() = %q, Generation() = %d after file change", c.Password(), c.Generation())
+	}
+
+	// 读取失败时保留原密码
+	os.Remove(file)
+	c.Reload()
+	if c.Password() != "new" {
+		t.Errorf("Password() = %q after file removed, want new", c.Password())
+	}
+}
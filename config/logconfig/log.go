@@ -1,14 +1,18 @@
 package logconfig
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	rotatelogsbytime "github.com/patch-mirrors/file-rotatelogs"
+	"github.com/zhouchang2017/toolkit/config"
 	"github.com/zhouchang2017/toolkit/log"
 
 	rotators "gopkg.in/natefinch/lumberjack.v2"
@@ -101,6 +105,52 @@ func (config *Configs) Init() (err error) {
 	return nil
 }
 
+var levels = map[string]bool{
+	"": true, "debug": true, "info": true, "warn": true, "error": true, "dpanic": true, "panic": true, "fatal": true,
+}
+
+// 配置校验
+func (config *Configs) Validate() error {
+	if config == nil {
+		return nil
+	}
+	for subSection, item := range *config {
+		if _, err := getFactory(item.Driver); err != nil {
+			return fmt.Errorf("log [%s] %s", subSection, err.Error())
+		}
+		if !levels[strings.ToLower(item.Level)] {
+			return fmt.Errorf("log [%s] unknown level %q", subSection, item.Level)
+		}
+	}
+	return nil
+}
+
+// 检查日志目录是否可写
+func (c *Configs) Probe(ctx context.Context) []config.ProbeResult {
+	if c == nil {
+		return nil
+	}
+	results := make([]config.ProbeResult, 0, len(*c))
+	for subSection, item := range *c {
+		if item.Path == "" {
+			continue
+		}
+		start := time.Now()
+		err := checkWritable(filepath.Dir(item.Path))
+		results = append(results, config.ProbeResult{Name: subSection, Err: err, Cost: time.Since(start)})
+	}
+	return results
+}
+
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".toolkit-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // 热更新
 type HotUpdate interface {
 	OnChange(c *Config) error
@@ -0,0 +1,76 @@
+package metricsconfig
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/logconfig"
+	"github.com/zhouchang2017/toolkit/log"
+	"github.com/zhouchang2017/toolkit/metrics"
+)
+
+var (
+	collector *metrics.Collector
+	mu        sync.RWMutex
+)
+
+type Config struct {
+	// 采集间隔, 默认 15s
+	Interval time.Duration
+	// 是否定时输出日志
+	Log bool
+	// 日志名称, 为空时使用默认日志
+	Logger string
+}
+
+// on server starting
+func (c *Config) Init() error {
+	if c == nil {
+		return nil
+	}
+	var logger log.FieldLogger
+	if c.Log {
+		logger = log.Logger
+		if c.Logger != "" {
+			l, err := logconfig.Get(c.Logger)
+			if err != nil {
+				return err
+			}
+			logger = l
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if collector != nil {
+		collector.Stop()
+	}
+	collector = metrics.NewCollector(c.Interval, logger)
+	collector.Start()
+	return nil
+}
+
+// on server closing
+func (c *Config) Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if collector != nil {
+		collector.Stop()
+		collector = nil
+	}
+	return nil
+}
+
+// Prometheus 指标接口, 未初始化时实时采集
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		c := collector
+		mu.RUnlock()
+		if c == nil {
+			c = metrics.NewCollector(0, nil)
+			c.Collect()
+		}
+		c.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,350 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerOpenTimeout = 30 * time.Second
+	defaultBreakerHalfOpen    = 1
+)
+
+var ErrUnavailable = errors.New("db unavailable")
+
+// 熔断或并发已满时快速失败, 可通过 errors.Is(err, ErrUnavailable) 判断
+type UnavailableError struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("DBHandler[%s] unavailable: %s", e.Name, e.Reason)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// 熔断配置, error_rate 与 slow_rate 均为 0 时不启用
+type BreakerConfig struct {
+	// 统计窗口内错误率达到该值时熔断, 0~1
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// 耗时超过 slow_call 的请求比例达到该值时熔断, 0~1
+	SlowRate float64       `mapstructure:"slow_rate"`
+	SlowCall time.Duration `mapstructure:"slow_call"`
+	// 统计窗口, 默认 10s
+	Window time.Duration
+	// 窗口内请求数达到该值才计算比例, 默认 20
+	MinRequests int `mapstructure:"min_requests"`
+	// 熔断持续时间, 之后进入半开状态, 默认 30s
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+	// 半开状态放行的探测请求数, 全部成功后恢复, 默认 1
+	HalfOpenRequests int `mapstructure:"half_open_requests"`
+}
+
+// 并发隔离配置, max_concurrent 为 0 时不启用
+type BulkheadConfig struct {
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// 并发已满时的最长等待时间, 为 0 时立即失败
+	MaxWait time.Duration `mapstructure:"max_wait"`
+}
+
+func (c BreakerConfig) enabled() bool {
+	return c.ErrorRate > 0 || (c.SlowRate > 0 && c.SlowCall > 0)
+}
+
+func (c Config) validateBreaker() error {
+	b := c.Breaker
+	if b.ErrorRate < 0 || b.ErrorRate > 1 || b.SlowRate < 0 || b.SlowRate > 1 {
+		return fmt.Errorf("breaker error_rate and slow_rate must be between 0 and 1")
+	}
+	if b.SlowCall < 0 || b.Window < 0 || b.MinRequests < 0 || b.OpenTimeout < 0 || b.HalfOpenRequests < 0 {
+		return fmt.Errorf("breaker options must not be negative")
+	}
+	if c.Bulkhead.MaxConcurrent < 0 || c.Bulkhead.MaxWait < 0 {
+		return fmt.Errorf("bulkhead options must not be negative")
+	}
+	return nil
+}
+
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+var stateNames = [...]string{"closed", "open", "half-open"}
+
+type breaker struct {
+	name   string
+	config BreakerConfig
+	mu     sync.Mutex
+	state  int
+	// 状态或窗口变化时递增, 忽略之前发出的请求结果
+	generation uint64
+	expiry     time.Time
+	requests   int
+	failures   int
+	slow       int
+	// 半开状态已放行及成功的请求数
+	probes    int
+	successes int
+}
+
+func newBreaker(name string, c BreakerConfig) *breaker {
+	if c.Window <= 0 {
+		c.Window = defaultBreakerWindow
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaultBreakerMinRequests
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = defaultBreakerHalfOpen
+	}
+	b := &breaker{name: name, config: c}
+	b.setState(stateClosed, time.Now())
+	return b
+}
+
+func (b *breaker) setState(state int, now time.Time) {
+	if b.state != state {
+		msg := fmt.Sprintf("db [%s] circuit breaker %s -> %s", b.name, stateNames[b.state], stateNames[state])
+		if state == stateOpen {
+			log.Logger.Warnf("%s, requests %d failures %d slow %d", msg, b.requests, b.failures, b.slow)
+		} else {
+			log.Logger.Info(msg)
+		}
+	}
+	b.state = state
+	b.generation++
+	b.requests, b.failures, b.slow, b.probes, b.successes = 0, 0, 0, 0, 0
+	switch state {
+	case stateClosed:
+		b.expiry = now.Add(b.config.Window)
+	case stateOpen:
+		b.expiry = now.Add(b.config.OpenTimeout)
+	default:
+		b.expiry = time.Time{}
+	}
+}
+
+// 按时间推进状态: 关闭状态滚动窗口, 熔断到期进入半开
+func (b *breaker) current(now time.Time) {
+	switch b.state {
+	case stateClosed:
+		if now.After(b.expiry) {
+			b.generation++
+			b.requests, b.failures, b.slow = 0, 0, 0
+			b.expiry = now.Add(b.config.Window)
+		}
+	case stateOpen:
+		if now.After(b.expiry) {
+			b.setState(stateHalfOpen, now)
+		}
+	}
+}
+
+func (b *breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current(time.Now())
+	switch b.state {
+	case stateOpen:
+		return 0, &UnavailableError{Name: b.name, Reason: "circuit breaker open"}
+	case stateHalfOpen:
+		if b.probes >= b.config.HalfOpenRequests {
+			return 0, &UnavailableError{Name: b.name, Reason: "circuit breaker half-open"}
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+func (b *breaker) done(generation uint64, cost time.Duration, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.current(now)
+	if generation != b.generation {
+		return
+	}
+	slow := b.config.SlowCall > 0 && cost >= b.config.SlowCall
+	switch b.state {
+	case stateClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if b.requests < b.config.MinRequests {
+			return
+		}
+		if (b.config.ErrorRate > 0 && float64(b.failures) >= b.config.ErrorRate*float64(b.requests)) ||
+			(b.config.SlowRate > 0 && float64(b.slow) >= b.config.SlowRate*float64(b.requests)) {
+			b.setState(stateOpen, now)
+		}
+	case stateHalfOpen:
+		if failed || (slow && b.config.SlowRate > 0) {
+			b.setState(stateOpen, now)
+			return
+		}
+		if b.successes++; b.successes >= b.config.HalfOpenRequests {
+			b.setState(stateClosed, now)
+		}
+	}
+}
+
+// 放行后未执行的请求不计入统计
+func (b *breaker) cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == stateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current(time.Now())
+	return stateNames[b.state]
+}
+
+// 计入熔断的错误, 服务端返回的业务错误说明实例正常
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, sql.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		// too many connections, lock wait timeout
+		case 1040, 1205:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// 熔断及并发隔离
+type guard struct {
+	name     string
+	breaker  *breaker
+	bulkhead chan struct{}
+	maxWait  time.Duration
+}
+
+func newGuard(name string, c Config) *guard {
+	g := &guard{name: name, maxWait: c.Bulkhead.MaxWait}
+	if c.Breaker.enabled() {
+		g.breaker = newBreaker(name, c.Breaker)
+	}
+	if c.Bulkhead.MaxConcurrent > 0 {
+		g.bulkhead = make(chan struct{}, c.Bulkhead.MaxConcurrent)
+	}
+	return g
+}
+
+func (g *guard) acquire(ctx context.Context) (func(err error), error) {
+	var generation uint64
+	if g.breaker != nil {
+		var err error
+		if generation, err = g.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	if g.bulkhead != nil {
+		if err := g.enter(ctx); err != nil {
+			if g.breaker != nil {
+				g.breaker.cancel(generation)
+			}
+			return nil, err
+		}
+	}
+	start := time.Now()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			if g.bulkhead != nil {
+				<-g.bulkhead
+			}
+			if g.breaker != nil {
+				g.breaker.done(generation, time.Since(start), isFailure(err))
+			}
+		})
+	}, nil
+}
+
+func (g *guard) enter(ctx context.Context) error {
+	select {
+	case g.bulkhead <- struct{}{}:
+		return nil
+	default:
+	}
+	if g.maxWait <= 0 {
+		return &UnavailableError{Name: g.name, Reason: "too many concurrent requests"}
+	}
+	timer := time.NewTimer(g.maxWait)
+	defer timer.Stop()
+	select {
+	case g.bulkhead <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return &UnavailableError{Name: g.name, Reason: "too many concurrent requests"}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func noop(error) {}
+
+// 执行前获取许可, 熔断或并发已满时返回 *UnavailableError, 执行结束后以执行结果调用 done
+func Acquire(ctx context.Context, dbHandler string) (done func(err error), err error) {
+	h, ok := instances.get(dbHandler)
+	if !ok || h.guard == nil {
+		return noop, nil
+	}
+	return h.guard.acquire(ctx)
+}
+
+// 熔断状态 closed|open|half-open, 未启用熔断时为空
+func BreakerState(dbHandler string) string {
+	h, ok := instances.get(dbHandler)
+	if !ok || h.guard == nil || h.guard.breaker == nil {
+		return ""
+	}
+	return h.guard.breaker.State()
+}
+
+// 连接池对应的配置段名称, 用于只持有 *sql.DB 的场景
+func NameOf(db *sql.DB) (string, bool) {
+	for _, name := range instances.names() {
+		h, ok := instances.get(name)
+		if !ok {
+			continue
+		}
+		h.mu.RLock()
+		found := h.db == db
+		h.mu.RUnlock()
+		if found {
+			return name, true
+		}
+	}
+	return "", false
+}
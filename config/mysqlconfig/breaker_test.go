@@ -0,0 +1,108 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker("test", BreakerConfig{ErrorRate: 0.5, MinRequests: 4, OpenTimeout: 50 * time.Millisecond, HalfOpenRequests: 2})
+	fail := errors.New("bad conn")
+	results := []bool{false, true, false, true}
+	for _, failed := range results {
+		gen, err := b.allow()
+		if err != nil {
+			t.Fatalf("allow() error = %v", err)
+		}
+		b.done(gen, time.Millisecond, failed)
+	}
+	if got := b.State(); got != "open" {
+		t.Fatalf("State() = %s, want open", got)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("allow() error = %v, want ErrUnavailable", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	gen1, err := b.allow()
+	if err != nil || b.State() != "half-open" {
+		t.Fatalf("allow() error = %v, state %s", err, b.State())
+	}
+	gen2, _ := b.allow()
+	if _, err := b.allow(); err == nil {
+		t.Fatal("allow() beyond half_open_requests should fail")
+	}
+	b.done(gen1, time.Millisecond, isFailure(nil))
+	b.done(gen2, time.Millisecond, isFailure(fail))
+	if got := b.State(); got != "open" {
+		t.Fatalf("State() = %s, want open after failed probe", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		gen, err := b.allow()
+		if err != nil {
+			t.Fatalf("allow() error = %v", err)
+		}
+		b.done(gen, time.Millisecond, false)
+	}
+	if got := b.State(); got != "closed" {
+		t.Fatalf("State() = %s, want closed", got)
+	}
+}
+
+func TestBreaker_Slow(t *testing.T) {
+	b := newBreaker("test", BreakerConfig{SlowRate: 1, SlowCall: 10 * time.Millisecond, MinRequests: 2})
+	for i := 0; i < 2; i++ {
+		gen, _ := b.allow()
+		b.done(gen, 20*time.Millisecond, false)
+	}
+	if got := b.State(); got != "open" {
+		t.Errorf("State() = %s, want open", got)
+	}
+}
+
+func TestGuard_Bulkhead(t *testing.T) {
+	g := newGuard("test", Config{Bulkhead: BulkheadConfig{MaxConcurrent: 1, MaxWait: 20 * time.Millisecond}})
+	done, err := g.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	var unavailable *UnavailableError
+	if _, err := g.acquire(context.Background()); !errors.As(err, &unavailable) {
+		t.Fatalf("acquire() error = %v, want *UnavailableError", err)
+	}
+	done(nil)
+	done(nil)
+	next, err := g.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() after release error = %v", err)
+	}
+	next(nil)
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{sql.ErrNoRows, false},
+		{context.Canceled, false},
+		{&mysql.MySQLError{Number: 1062, Message: "duplicate"}, false},
+		{&mysql.MySQLError{Number: 1205, Message: "lock wait timeout"}, true},
+		{driver.ErrBadConn, true},
+		{context.DeadlineExceeded, true},
+	}
+	for _, tt := range tests {
+		if got := isFailure(tt.err); got != tt.want {
+			t.Errorf("isFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/credential"
+)
+
+var (
+	_ driver.Connector          = &connector{}
+	_ driver.ConnPrepareContext = &traceConn{}
+	_ driver.ConnBeginTx        = &traceConn{}
+	_ driver.ExecerContext      = &traceConn{}
+	_ driver.QueryerContext     = &traceConn{}
+	_ driver.Pinger             = &traceConn{}
+	_ driver.SessionResetter    = &traceConn{}
+	_ driver.NamedValueChecker  = &traceConn{}
+	_ driver.Validator          = &traceConn{}
+	_ driver.StmtExecContext    = &traceStmt{}
+	_ driver.StmtQueryContext   = &traceStmt{}
+	_ driver.ColumnConverter    = &traceStmt{}
+)
+
+// 连接器, 每次建立物理连接时调用, 开启 trace_driver 时包装连接以记录语句,
+// 密码可轮换或配置多主机时使用当前密码及主库建立连接, 并淘汰过期的空闲连接,
+// 新建的连接执行会话变量及初始化钩子, 失败时不放入连接池
+type connector struct {
+	name     string
+	config   Config
+	driver   driver.Driver
+	creds    *credential.Credential
+	failover *failover
+}
+
+// 未开启 trace_driver, 密码不轮换, 未配置多主机及连接初始化时不需要连接器
+func (c Config) plain(name string) bool {
+	return !c.TraceDriver && !c.passwordSource(name).Dynamic() && len(c.Hosts) == 0 &&
+		len(c.SessionVars) == 0 && len(c.InitSQL) == 0 && c.InitHook == ""
+}
+
+func newConnector(name string, c Config) (*connector, error) {
+	// 通过 database/sql 取得已注册的驱动
+	db, err := sql.Open(c.driverName(), c.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	conn := &connector{name: name, config: c, driver: db.Driver()}
+	if src := c.passwordSource(name); src.Dynamic() {
+		if conn.creds, err = credential.Watch(src); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Hosts) > 0 {
+		if conn.failover, err = openFailover(name, c); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conf := c.config
+	var stale []func() bool
+	if c.creds != nil {
+		generation := c.creds.Generation()
+		conf.Password = c.creds.Password()
+		stale = append(stale, func() bool { return c.creds.Generation() != generation })
+	}
+	if c.failover != nil {
+		addr, generation := c.failover.target()
+		if addr == "" {
+			return nil, fmt.Errorf("db [%s] %w among %v", c.name, errNoPrimary, c.config.hostAddrs())
+		}
+		conf = conf.nodeConfig(addr)
+		stale = append(stale, func() bool { return atomic.LoadUint64(&c.failover.generation) != generation })
+	}
+	dsn := conf.String()
+	var conn driver.Conn
+	var err error
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		var dconn driver.Connector
+		if dconn, err = dc.OpenConnector(dsn); err == nil {
+			conn, err = dconn.Connect(ctx)
+		}
+	} else {
+		conn, err = c.driver.Open(dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conf.initConn(ctx, c.name, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if c.config.TraceDriver || len(stale) > 0 {
+		return &traceConn{Conn: conn, name: c.name, config: c.config, stale: stale}, nil
+	}
+	return conn, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// 停止刷新密码及主库检查, 可重复调用
+func (c *connector) Close() error {
+	if c.failover != nil {
+		c.failover.close()
+	}
+	if c.creds != nil {
+		return c.creds.Close()
+	}
+	return nil
+}
+
+// 关闭连接池及其连接器, sql.DB 在 Go 1.17 之前不会调用连接器的 Close
+func closePool(db *sql.DB, conn *connector) error {
+	err := db.Close()
+	if conn != nil {
+		conn.Close()
+	}
+	return err
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func rowsAffected(result driver.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// 包装的连接, 开启 trace_driver 时记录语句耗时
+type traceConn struct {
+	driver.Conn
+	name   string
+	config Config
+	// 密码已轮换或主库已切换
+	stale []func() bool
+}
+
+func (c *traceConn) observe(ctx context.Context, query string, args []driver.NamedValue, start time.Time, rows int64, err error) {
+	if err == driver.ErrSkip || !c.config.TraceDriver {
+		return
+	}
+	observe(ctx, c.name, c.config, Statement{
+		Query: query,
+		Args:  namedValues(args),
+		Rows:  rows,
+		Cost:  time.Since(start),
+		Err:   err,
+	})
+}
+
+func (c *traceConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.observe(ctx, query, args, start, rowsAffected(result), err)
+	return result, err
+}
+
+func (c *traceConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.observe(ctx, query, args, start, -1, err)
+	return rows, err
+}
+
+func (c *traceConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &traceStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *traceConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *traceConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support non-default isolation level or read-only transactions")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *traceConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *traceConn) ResetSession(ctx context.Context) error {
+	for _, stale := range c.stale {
+		if stale() {
+			// 丢弃连接, 由连接池使用新密码或新主库重新建立
+			return driver.ErrBadConn
+		}
+	}
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// 密码已轮换或主库已切换时不再放回连接池
+func (c *traceConn) IsValid() bool {
+	for _, stale := range c.stale {
+		if stale() {
+			return false
+		}
+	}
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *traceConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// 记录预编译语句耗时
+type traceStmt struct {
+	driver.Stmt
+	conn  *traceConn
+	query string
+}
+
+func (s *traceStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	start := time.Now()
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = driverValues(args); err == nil {
+			result, err = s.Stmt.Exec(values)
+		}
+	}
+	s.conn.observe(ctx, s.query, args, start, rowsAffected(result), err)
+	return result, err
+}
+
+func (s *traceStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	start := time.Now()
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = driverValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	s.conn.observe(ctx, s.query, args, start, -1, err)
+	return rows, err
+}
+
+func (s *traceStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if converter, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return converter.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+func driverValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
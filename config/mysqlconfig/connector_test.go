@@ -0,0 +1,244 @@
+package mysqlconfig
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+var fake = &fakesql.Driver{}
+
+func init() {
+	sql.Register("toolkit-fake", fake)
+	RegisterDriver("toolkit-fake", DialectMySQL, "", func(c Config) string {
+		return c.Username + ":" + c.Password + "@" + c.Host
+	})
+}
+
+func TestConfig_OpenTraceDriver(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = log.NewZapLogger("json", false, "debug", &buf)
+	defer func() { log.Logger = logger }()
+
+	RegisterStatementHooks(testHooks{})
+	defer RegisterStatementHooks(noopHooks{})
+
+	fake.Handle(func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+		return &fakesql.Result{RowsAffected: 2}, nil
+	})
+	defer fake.Reset()
+
+	c := Config{Driver: "toolkit-fake", Host: "fake", TraceDriver: true, SlowThreshold: time.Nanosecond}
+	db, err := c.open("fake")
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	defer db.Close()
+
+	ctx := WithTable(context.Background(), "users")
+	if _, err := db.ExecContext(ctx, "UPDATE users SET name=? WHERE id IN (?,?)", "secret", 1, 2); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`"handle":"fake"`, `"table":"users"`, `"fingerprint":"update users set name=? where id in (?,?)"`, `"args":["***","***","***"]`, `"rows":2`, "slow sql"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log %s does not contain %s", out, want)
+		}
+	}
+}
+
+// 语句指纹转为小写, 参数全部脱敏
+type testHooks struct{}
+
+func (testHooks) Fingerprint(query string) string {
+	return strings.ToLower(query)
+}
+
+func (testHooks) MaskArgs(args []interface{}) []string {
+	masked := make([]string, len(args))
+	for i := range args {
+		masked[i] = "***"
+	}
+	return masked
+}
+
+func (testHooks) Record(handle string, query string, cost time.Duration, err error) {}
+
+func TestConfig_openConnector(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wrapped bool
+	}{
+		{"plain", Config{Driver: "toolkit-fake", Host: "plain"}, false},
+		{"trace", Config{Driver: "toolkit-fake", Host: "trace", TraceDriver: true}, true},
+		{"session", Config{Driver: "toolkit-fake", Host: "session", InitSQL: []string{"SELECT 1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn, err := tt.config.openConnector(tt.name)
+			if err != nil {
+				t.Fatalf("openConnector() error = %v", err)
+			}
+			defer db.Close()
+			if (conn != nil) != tt.wrapped {
+				t.Errorf("connector = %v, want wrapped %v", conn, tt.wrapped)
+			}
+		})
+	}
+}
+
+func TestConfig_OpenWithoutHooks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = log.NewZapLogger("json", false, "debug", &buf)
+	defer func() { log.Logger = logger }()
+
+	c := Config{Driver: "toolkit-fake", Host: "fake", TraceDriver: true, SlowThreshold: time.Nanosecond}
+	db, err := c.open("fake")
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("UPDATE users SET name=? WHERE id=?", "secret", 1); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	// 未注册钩子时记录原始语句, 不记录参数
+	out := buf.String()
+	if !strings.Contains(out, `"fingerprint":"UPDATE users SET name=? WHERE id=?"`) || strings.Contains(out, "secret") {
+		t.Errorf("log %s", out)
+	}
+}
+
+// 过期的连接不再放回连接池
+type validConn struct {
+	driver.Conn
+	valid bool
+}
+
+func (c *validConn) IsValid() bool {
+	return c.valid
+}
+
+func TestTraceConn_IsValid(t *testing.T) {
+	plain, err := fake.Open("validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := false
+	tests := []struct {
+		name  string
+		conn  driver.Conn
+		stale bool
+		want  bool
+	}{
+		{"valid", &validConn{valid: true}, false, true},
+		{"invalid", &validConn{valid: false}, false, false},
+		{"stale", &validConn{valid: true}, true, false},
+		{"no validator", plain, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale = tt.stale
+			conn := &traceConn{Conn: tt.conn, stale: []func() bool{func() bool { return stale }}}
+			if got := conn.IsValid(); got != tt.want {
+				t.Errorf("IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnector_RotatePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysqlconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := newConnector("rotate", Config{Driver: "toolkit-fake", Host: "rotate", PasswordFile: file})
+	if err != nil {
+		t.Fatalf("newConnector() error = %v", err)
+	}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+	lastDSN := func() string {
+		dsns := fake.DSNs()
+		return dsns[len(dsns)-1]
+	}
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if got := lastDSN(); got != ":old@rotate" {
+		t.Fatalf("dsn = %s, want :old@rotate", got)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conn.creds.Reload()
+	// 空闲连接使用旧密码, 复用时被丢弃并使用新密码重新建立
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if got := lastDSN(); got != ":new@rotate" {
+		t.Errorf("dsn = %s, want :new@rotate", got)
+	}
+}
+
+// 关闭 OpenPool 返回的连接池时停止刷新密码及主库检查
+func TestConfig_OpenPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysqlconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	failoverState.set("a:3306", false, false)
+	failoverState.set("b:3306", true, false)
+	c := Config{Driver: "toolkit-failover", Hosts: []string{"a", "b"}, PasswordFile: file, FailoverInterval: 10 * time.Millisecond}
+
+	if _, err := c.Open(); err == nil {
+		t.Fatal("Open() accepted hosts and password_file")
+	}
+	before := runtime.NumGoroutine()
+	db, closer, err := c.OpenPool()
+	if err != nil {
+		t.Fatalf("OpenPool() error = %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if n := runtime.NumGoroutine(); n <= before {
+		t.Fatalf("goroutines = %d after OpenPool, want more than %d", n, before)
+	}
+	if err := closer(); err != nil {
+		t.Fatalf("close error = %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines = %d after close, want at most %d", n, before)
+	}
+}
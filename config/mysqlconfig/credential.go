@@ -0,0 +1,13 @@
+package mysqlconfig
+
+import "github.com/zhouchang2017/toolkit/config/credential"
+
+func (c Config) passwordSource(name string) credential.Source {
+	return credential.Source{
+		Key:      "mysql." + name,
+		Password: c.Password,
+		File:     c.PasswordFile,
+		Provider: c.PasswordProvider,
+		Refresh:  c.PasswordRefresh,
+	}
+}
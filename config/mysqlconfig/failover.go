@@ -0,0 +1,279 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const defaultFailoverInterval = 5 * time.Second
+
+var errNoPrimary = errors.New("no writable primary")
+
+// 候选节点状态
+type Node struct {
+	Addr     string
+	Healthy  bool
+	ReadOnly bool
+	Primary  bool
+	Err      string
+	Latency  time.Duration
+	// 最近一次检查时间
+	CheckedAt time.Time
+}
+
+// 多主机配置的当前拓扑
+type Topology struct {
+	Name    string
+	Primary string
+	Nodes   []Node
+}
+
+type failoverNode struct {
+	addr string
+	// 健康检查专用连接池
+	db    *sql.DB
+	conn  *connector
+	state Node
+}
+
+// 监控候选主机, 按 @@read_only 识别可写的主库
+type failover struct {
+	name     string
+	dialect  string
+	interval time.Duration
+	nodes    []*failoverNode
+	mu       sync.RWMutex
+	primary  int
+	// 主库变化时递增, 连接到旧主库的空闲连接在复用时被丢弃
+	generation uint64
+	stop       chan struct{}
+	once       sync.Once
+}
+
+// 候选主机地址, 未指定端口时使用 port 配置
+func (c Config) hostAddrs() []string {
+	addrs := make([]string, 0, len(c.Hosts))
+	for _, host := range c.Hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			conf := c
+			conf.Host = host
+			host = conf.addr()
+		}
+		addrs = append(addrs, host)
+	}
+	return addrs
+}
+
+func (c Config) validateHosts() error {
+	if len(c.Hosts) == 0 {
+		return nil
+	}
+	if c.Dialect() == DialectSQLite {
+		return fmt.Errorf("hosts is not supported by %s", c.driverName())
+	}
+	for _, addr := range c.hostAddrs() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid host %q: %s", addr, err.Error())
+		}
+	}
+	return nil
+}
+
+// 指定主机的连接配置
+func (c Config) nodeConfig(addr string) Config {
+	conf := c
+	conf.Hosts = nil
+	conf.Replicas = nil
+	conf.Host, conf.Port, _ = net.SplitHostPort(addr)
+	return conf
+}
+
+// 检查全部候选主机并在后台定期检查
+func openFailover(name string, c Config) (*failover, error) {
+	interval := c.FailoverInterval
+	if interval <= 0 {
+		interval = defaultFailoverInterval
+	}
+	f := &failover{name: name, dialect: c.Dialect(), interval: interval, primary: -1, stop: make(chan struct{})}
+	for _, addr := range c.hostAddrs() {
+		conf := c.nodeConfig(addr)
+		// 健康检查不记录语句
+		conf.TraceDriver, conf.QueryStats = false, false
+		conn, err := newConnector(name, conf)
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+		db := sql.OpenDB(conn)
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		f.nodes = append(f.nodes, &failoverNode{addr: addr, db: db, conn: conn, state: Node{Addr: addr}})
+	}
+	// 没有可写主库时建立连接返回错误, 由后台检查在主库出现后切换
+	f.check()
+	go f.monitor()
+	return f, nil
+}
+
+func (f *failover) current() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.primary
+}
+
+// 当前主库地址及版本, 没有可写主库时地址为空
+func (f *failover) target() (string, uint64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	addr := ""
+	if f.primary >= 0 {
+		addr = f.nodes[f.primary].addr
+	}
+	return addr, atomic.LoadUint64(&f.generation)
+}
+
+func (f *failover) readOnlyQuery() string {
+	if f.dialect == DialectPostgres {
+		return "SELECT pg_is_in_recovery()"
+	}
+	return "SELECT @@global.read_only"
+}
+
+func (f *failover) probe(node *failoverNode) Node {
+	ctx, cancel := context.WithTimeout(context.Background(), f.interval)
+	defer cancel()
+	start := time.Now()
+	state := Node{Addr: node.addr, CheckedAt: start}
+	err := node.db.QueryRowContext(ctx, f.readOnlyQuery()).Scan(&state.ReadOnly)
+	state.Latency = time.Since(start)
+	if err != nil {
+		state.Err = err.Error()
+	}
+	state.Healthy = err == nil
+	return state
+}
+
+// 并发检查所有节点, 当前主库仍可写时保持不变, 否则按配置顺序选择第一个可写节点
+func (f *failover) check() {
+	states := make([]Node, len(f.nodes))
+	var wg sync.WaitGroup
+	for i, node := range f.nodes {
+		wg.Add(1)
+		go func(i int, node *failoverNode) {
+			defer wg.Done()
+			states[i] = f.probe(node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	writable := func(i int) bool {
+		return i >= 0 && states[i].Healthy && !states[i].ReadOnly
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old := f.primary
+	next := old
+	if !writable(old) {
+		next = -1
+		for i := range states {
+			if writable(i) {
+				next = i
+				break
+			}
+		}
+	}
+	for i, node := range f.nodes {
+		if node.state.Healthy != states[i].Healthy && !node.state.CheckedAt.IsZero() {
+			if states[i].Healthy {
+				log.Logger.Infof("db [%s] host [%s] recovered", f.name, node.addr)
+			} else {
+				log.Logger.Warnf("db [%s] host [%s] unhealthy: %s", f.name, node.addr, states[i].Err)
+			}
+		}
+		node.state = states[i]
+	}
+	switch {
+	case next < 0:
+		// 保留原主库, 等待下一次检查
+		log.Logger.Errorf("db [%s] %s", f.name, errNoPrimary)
+	case next != old:
+		f.primary = next
+		atomic.AddUint64(&f.generation, 1)
+		if old < 0 {
+			log.Logger.Infof("db [%s] primary [%s]", f.name, f.nodes[next].addr)
+		} else {
+			log.Logger.Warnf("db [%s] failover, primary [%s] -> [%s]", f.name, f.nodes[old].addr, f.nodes[next].addr)
+		}
+	}
+}
+
+func (f *failover) monitor() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+func (f *failover) topology() Topology {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	t := Topology{Name: f.name, Nodes: make([]Node, 0, len(f.nodes))}
+	for i, node := range f.nodes {
+		state := node.state
+		state.Primary = i == f.primary
+		if state.Primary {
+			t.Primary = node.addr
+		}
+		t.Nodes = append(t.Nodes, state)
+	}
+	return t
+}
+
+func (f *failover) close() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+	for _, node := range f.nodes {
+		closePool(node.db, node.conn)
+	}
+}
+
+// 多主机配置的当前拓扑, 未配置 hosts 或尚未连接时返回错误
+func GetTopology(dbHandler string) (Topology, error) {
+	h, ok := instances.get(dbHandler)
+	if !ok {
+		return Topology{}, fmt.Errorf("DBHandler[%s] not found", dbHandler)
+	}
+	h.mu.RLock()
+	f := h.failover
+	h.mu.RUnlock()
+	if f == nil {
+		return Topology{}, fmt.Errorf("DBHandler[%s] has no failover hosts", dbHandler)
+	}
+	return f.topology(), nil
+}
+
+// 所有多主机配置的当前拓扑
+func Topologies() []Topology {
+	topologies := make([]Topology, 0)
+	for _, name := range instances.names() {
+		if t, err := GetTopology(name); err == nil {
+			topologies = append(topologies, t)
+		}
+	}
+	return topologies
+}
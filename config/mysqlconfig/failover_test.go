@@ -0,0 +1,178 @@
+package mysqlconfig
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+)
+
+// 按 dsn 中的地址模拟主从状态
+type failoverNodes struct {
+	mu       sync.Mutex
+	readOnly map[string]bool
+	down     map[string]bool
+}
+
+func (n *failoverNodes) set(addr string, readOnly bool, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.readOnly[addr], n.down[addr] = readOnly, down
+}
+
+func (n *failoverNodes) dial(dsn string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down[dsn] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (n *failoverNodes) query(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down[dsn] {
+		return nil, driver.ErrBadConn
+	}
+	readOnly := int64(0)
+	if n.readOnly[dsn] {
+		readOnly = 1
+	}
+	return &fakesql.Result{Columns: []string{"@@global.read_only"}, Rows: [][]driver.Value{{readOnly}}}, nil
+}
+
+var (
+	failoverFake  = &fakesql.Driver{}
+	failoverState = &failoverNodes{readOnly: map[string]bool{}, down: map[string]bool{}}
+)
+
+func lastDial() string {
+	dsns := failoverFake.DSNs()
+	return dsns[len(dsns)-1]
+}
+
+func init() {
+	failoverFake.OnDial(failoverState.dial)
+	failoverFake.Handle(failoverState.query)
+	sql.Register("toolkit-failover", failoverFake)
+	RegisterDriver("toolkit-failover", DialectMySQL, "3306", func(c Config) string {
+		return c.Host + ":" + c.Port
+	})
+}
+
+func TestFailover(t *testing.T) {
+	failoverState.set("a:3306", false, false)
+	failoverState.set("b:3306", true, false)
+	c := Config{Driver: "toolkit-failover", Hosts: []string{"a", "b:3306"}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	db, conn, err := c.openConnector("ha")
+	if err != nil {
+		t.Fatalf("openConnector() error = %v", err)
+	}
+	defer db.Close()
+	if got := lastDial(); got != "a:3306" {
+		t.Fatalf("dial %s, want a:3306", got)
+	}
+
+	// a 降级为只读, b 提升为主库
+	failoverState.set("a:3306", true, false)
+	failoverState.set("b:3306", false, false)
+	conn.failover.check()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if got := lastDial(); got != "b:3306" {
+		t.Errorf("dial %s after failover, want b:3306", got)
+	}
+
+	// 主库不可用且没有其他可写节点时保留原主库
+	failoverState.set("b:3306", false, true)
+	conn.failover.check()
+	topology := conn.failover.topology()
+	if topology.Primary != "b:3306" || len(topology.Nodes) != 2 {
+		t.Fatalf("topology() = %+v", topology)
+	}
+	if a, b := topology.Nodes[0], topology.Nodes[1]; !a.Healthy || !a.ReadOnly || a.Primary || b.Healthy || !b.Primary {
+		t.Errorf("topology() nodes = %+v", topology.Nodes)
+	}
+}
+
+func TestFailover_NoPrimary(t *testing.T) {
+	failoverState.set("c:3306", true, false)
+	defer failoverState.set("c:3306", false, false)
+	c := Config{Driver: "toolkit-failover", Hosts: []string{"c:3306"}}
+
+	strict := c
+	strict.Mode = ModeStrict
+	if err := (&Configs{"ro": strict}).Init(); err == nil || !strings.Contains(err.Error(), errNoPrimary.Error()) {
+		t.Errorf("strict Init() error = %v, want errNoPrimary", err)
+	}
+
+	// 默认模式保留连接池, 主库出现后由后台检查切换
+	configs := &Configs{"ro": c}
+	if err := configs.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer configs.Close()
+	db, err := Get("ro")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if err := db.Ping(); !errors.Is(err, errNoPrimary) {
+		t.Errorf("Ping() without primary error = %v, want errNoPrimary", err)
+	}
+	failoverState.set("c:3306", false, false)
+	h, _ := instances.get("ro")
+	h.failover.check()
+	if err := db.Ping(); err != nil {
+		t.Errorf("Ping() after primary appears error = %v", err)
+	}
+	if topology, err := GetTopology("ro"); err != nil || topology.Primary != "c:3306" {
+		t.Errorf("GetTopology() = %+v, %v", topology, err)
+	}
+}
+
+func TestFailover_NodeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+
+	c := Config{Hosts: []string{"db1.local", "db2.local:3307"}, Port: "3306", TLS: "true", TLSCA: ca.file}
+	if err := c.registerTLS(); err != nil {
+		t.Fatalf("registerTLS() error = %v", err)
+	}
+	conf, err := c.tlsConfig()
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	for _, addr := range c.hostAddrs() {
+		dsn, err := mysql.ParseDSN(c.nodeConfig(addr).String())
+		if err != nil {
+			t.Fatalf("ParseDSN() error = %v", err)
+		}
+		if dsn.Addr != addr || dsn.TLSConfig != c.tlsName() {
+			t.Errorf("node dsn addr = %s tls = %s, want %s %s", dsn.Addr, dsn.TLSConfig, addr, c.tlsName())
+		}
+		// 驱动按节点地址的主机名校验证书
+		host, _, _ := net.SplitHostPort(dsn.Addr)
+		l := ca.serve(t, host)
+		if err := handshake(conf, host, l); err != nil {
+			t.Errorf("handshake(%s) error = %v", host, err)
+		}
+		l.Close()
+	}
+}
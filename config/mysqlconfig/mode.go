@@ -0,0 +1,99 @@
+package mysqlconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	// 启动时连接失败记录日志并保留连接池, 使用时重新连接
+	ModeDefault = ""
+	// 启动时连接失败则初始化失败
+	ModeStrict = "strict"
+	// 首次 Get 时建立连接
+	ModeLazy = "lazy"
+	// 启动时连接失败则在后台按指数退避重连
+	ModeRetry = "retry"
+
+	defaultRetryInterval    = time.Second
+	defaultRetryMaxInterval = time.Minute
+)
+
+var (
+	ErrNotReady = errors.New("db not ready")
+	errClosed   = errors.New("db closed")
+)
+
+// 连接尚不可用, 可通过 errors.Is(err, ErrNotReady) 判断
+type NotReadyError struct {
+	Name string
+	Err  error
+}
+
+func (e *NotReadyError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("DBHandler[%s] not ready", e.Name)
+	}
+	return fmt.Sprintf("DBHandler[%s] not ready: %s", e.Name, e.Err.Error())
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NotReadyError) Is(target error) bool {
+	return target == ErrNotReady
+}
+
+func (c Config) mode() string {
+	return strings.ToLower(c.Mode)
+}
+
+func (c Config) validateMode() error {
+	switch c.mode() {
+	case ModeDefault, ModeStrict, ModeLazy, ModeRetry:
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	if c.RetryInterval < 0 || c.RetryMaxInterval < 0 {
+		return fmt.Errorf("retry_interval and retry_max_interval must not be negative")
+	}
+	return nil
+}
+
+// 后台重连直至成功或被关闭
+func (h *handle) retry() {
+	interval := h.config.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	maxInterval := h.config.RetryMaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultRetryMaxInterval
+	}
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(interval)
+		select {
+		case <-h.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := h.connect()
+		if err == nil {
+			log.Logger.Infof("db [%s] connected after %d retries", h.name, attempt)
+			return
+		}
+		if err == errClosed {
+			return
+		}
+		log.Logger.Warnf("db [%s] retry %d open conn err:%s", h.name, attempt, err.Error())
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
@@ -1,25 +1,33 @@
 package mysqlconfig
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/zhouchang2017/toolkit/config"
 	"github.com/zhouchang2017/toolkit/log"
+	"net"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
-)
-
-var (
-	instances = map[string]*sql.DB{}
+	"time"
 )
 
 func Get(dbHandler string) (*sql.DB, error) {
-	if db, ok := instances[dbHandler]; ok {
-		return db, nil
+	if h, ok := instances.get(dbHandler); ok {
+		return h.get()
 	}
 	return nil, fmt.Errorf("DBHandler[%s] not found", dbHandler)
 }
 
+// 已注册的连接名称
+func Names() []string {
+	return instances.names()
+}
+
 type Configs map[string]Config
 
 func (c *Configs) Init() error {
@@ -27,36 +35,176 @@ func (c *Configs) Init() error {
 		return nil
 	}
 	for name, config := range *c {
-		db, err := config.Open()
+		h, err := openHandle(name, config)
+		if err != nil {
+			switch config.mode() {
+			case ModeStrict:
+				h.close()
+				return fmt.Errorf("db [%s] open conn err:%s", name, err.Error())
+			case ModeRetry:
+				log.Logger.Warnf("db [%s] open conn err:%s, retry in background", name, err.Error())
+			default:
+				log.Logger.Errorf("db [%s] open conn err:%s", name, err.Error())
+			}
+		}
+		instances.swap(name, h)
+	}
+	return nil
+}
+
+// 配置变更时重建连接池, 新连接池可用后替换旧连接池
+func (c *Configs) Change() error {
+	if c == nil {
+		return nil
+	}
+	for name, config := range *c {
+		old, ok := instances.get(name)
+		if ok && reflect.DeepEqual(old.config, config) {
+			continue
+		}
+		h, err := openHandle(name, config)
 		if err != nil {
 			log.Logger.Errorf("db [%s] open conn err:%s", name, err.Error())
+			if ok || config.mode() == ModeStrict {
+				log.Logger.Errorf("db [%s] reload failed, keep the old connection", name)
+				h.close()
+				continue
+			}
+		}
+		if old = instances.swap(name, h); old != nil {
+			go old.drain()
+		}
+		log.Logger.Infof("db [%s] reload success", name)
+	}
+	for _, name := range instances.names() {
+		if _, ok := (*c)[name]; ok {
+			continue
+		}
+		if old := instances.remove(name); old != nil {
+			go old.drain()
+		}
+		log.Logger.Infof("db [%s] removed", name)
+	}
+	return nil
+}
+
+func (c *Configs) Close() (err error) {
+	for _, h := range instances.reset() {
+		if e := h.close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// 配置校验
+func (c *Configs) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for name, config := range *c {
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("db [%s] %s", name, err.Error())
 		}
-		instances[name] = db
 	}
 	return nil
 }
 
-func (c *Configs) Close() {
-	for name, db := range instances {
-		if err := db.Close(); err != nil {
-			log.Logger.Errorf("db [%s] close err:%s", name, err.Error())
+// 连通性探测
+func (c *Configs) Probe(ctx context.Context) []config.ProbeResult {
+	if c == nil {
+		return nil
+	}
+	results := make([]config.ProbeResult, 0, len(*c))
+	for name, conf := range *c {
+		start := time.Now()
+		err := conf.Ping(ctx)
+		results = append(results, config.ProbeResult{Name: name, Err: err, Cost: time.Since(start)})
+		for _, r := range conf.Replicas {
+			start := time.Now()
+			rc := conf.replicaConfig(r)
+			err := rc.Ping(ctx)
+			results = append(results, config.ProbeResult{Name: name + "/" + rc.addr(), Err: err, Cost: time.Since(start)})
 		}
 	}
+	return results
 }
 
 type Config struct {
-	Host        string
-	Port        string
-	DB          string
-	Username    string
-	Password    string
-	Charset     string
+	// mysql|sqlite3|sqlite|postgres|pgx, 默认 mysql, 非 mysql 驱动需自行导入
+	Driver   string
+	Host     string
+	Port     string
+	DB       string
+	Username string
+	Password string
+	// 从文件或注册的 provider 读取密码, 定时或文件变化时重新读取, 新建的连接使用新密码
+	PasswordFile     string        `mapstructure:"password_file"`
+	PasswordProvider string        `mapstructure:"password_provider"`
+	PasswordRefresh  time.Duration `mapstructure:"password_refresh"`
+	Charset          string
+	Collation        string
+	// 时区, 默认 Local
+	Loc         string
 	MaxOpenConn int
 	MaxIdleConn int
-	Timeout     int
+	// 连接超时, 单位秒, 未设置 connect_timeout 时生效
+	Timeout           int
+	ConnectTimeout    time.Duration `mapstructure:"connect_timeout"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	InterpolateParams bool          `mapstructure:"interpolate_params"`
+	// false|true|skip-verify|preferred, 配置证书时使用自定义 tls 配置
+	TLS           string
+	TLSCA         string `mapstructure:"tls_ca"`
+	TLSCert       string `mapstructure:"tls_cert"`
+	TLSKey        string `mapstructure:"tls_key"`
+	TLSServerName string `mapstructure:"tls_server_name"`
+	// 其他 dsn 参数, 可覆盖默认值, 非驱动参数作为系统变量设置
+	Params          map[string]string
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// 从库, 用于读写分离
+	Replicas            []Replica
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	// 配置变更后等待旧连接池查询结束的最长时间, 默认 30s
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+	// 慢查询阈值, 为 0 时不记录
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// 以 debug 级别记录所有语句
+	LogStatements bool `mapstructure:"log_statements"`
+	// 包装驱动, 记录连接池执行的所有语句, 而不仅是 SQLDao
+	TraceDriver bool `mapstructure:"trace_driver"`
+	// 语句日志名称, 为空时使用默认日志
+	Logger string
+	// 按 sql 指纹聚合执行统计, 见 sqlstats
+	QueryStats bool `mapstructure:"query_stats"`
+	// 连接模式 strict|lazy|retry, 未配置时连接失败只记录日志
+	Mode             string
+	RetryInterval    time.Duration `mapstructure:"retry_interval"`
+	RetryMaxInterval time.Duration `mapstructure:"retry_max_interval"`
+	// 熔断及并发隔离, 作用于 SQLDao 及 utils.Transaction
+	Breaker  BreakerConfig
+	Bulkhead BulkheadConfig
+	// 死锁等临时错误的重试策略, 作用于 SQLDao 的读操作及 utils.Transaction
+	RetryPolicy RetryPolicy `mapstructure:"retry_policy"`
+	// 多主机, host:port, 后台检查并连接到可写的主库, 配置后忽略 host 及 port
+	Hosts            []string
+	FailoverInterval time.Duration `mapstructure:"failover_interval"`
+	// 会话变量, 每个新建的物理连接执行 SET SESSION name = value, sqlite 为 PRAGMA
+	SessionVars map[string]string `mapstructure:"session_vars"`
+	// 会话变量之后执行的初始化语句
+	InitSQL []string `mapstructure:"init_sql"`
+	// 通过 RegisterInitHook 注册的初始化钩子, 最后执行
+	InitHook string `mapstructure:"init_hook"`
 }
 
 func (c Config) String() string {
+	return c.driver().dsn(c)
+}
+
+// mysql dsn
+func mysqlDSN(c Config) string {
 	var buf strings.Builder
 	if c.Username != "" && c.Password != "" {
 		buf.WriteString(url.UserPassword(c.Username, c.Password).String())
@@ -73,28 +221,124 @@ func (c Config) String() string {
 	buf.WriteString(":")
 	buf.WriteString(c.Port)
 	buf.WriteString(")")
-	if c.DB != "" {
-		buf.WriteString("/")
-		buf.WriteString(c.DB)
+	buf.WriteString("/")
+	buf.WriteString(c.DB)
+	buf.WriteString("?")
+	buf.WriteString(c.params().Encode())
+	defer buf.Reset()
+	return buf.String()
+}
+
+func (c Config) addr() string {
+	if c.Dialect() == DialectSQLite {
+		return sqliteDSN(Config{DB: c.DB})
 	}
+	if c.Port == "" {
+		c.Port = c.driver().port
+	}
+	if c.Host == "" {
+		c.Host = "127.0.0.1"
+	}
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+func (c Config) params() url.Values {
 	values := url.Values{}
 	if c.Charset == "" {
 		c.Charset = "utf8mb4"
 	}
-	values.Add("charset", c.Charset)
-	values.Add("parseTime", "True")
-	values.Add("loc", "Local")
+	values.Set("charset", c.Charset)
+	if c.Collation != "" {
+		values.Set("collation", c.Collation)
+	}
+	values.Set("parseTime", "True")
+	if c.Loc == "" {
+		c.Loc = "Local"
+	}
+	values.Set("loc", c.Loc)
+	if c.ConnectTimeout == 0 && c.Timeout > 0 {
+		c.ConnectTimeout = time.Duration(c.Timeout) * time.Second
+	}
+	if c.ConnectTimeout > 0 {
+		values.Set("timeout", c.ConnectTimeout.String())
+	}
+	if c.ReadTimeout > 0 {
+		values.Set("readTimeout", c.ReadTimeout.String())
+	}
+	if c.WriteTimeout > 0 {
+		values.Set("writeTimeout", c.WriteTimeout.String())
+	}
+	if c.InterpolateParams {
+		values.Set("interpolateParams", "true")
+	}
+	if tls := c.tlsParam(); tls != "" {
+		values.Set("tls", tls)
+	}
+	for k, v := range c.Params {
+		if name, ok := driverParams[strings.ToLower(k)]; ok {
+			k = name
+		}
+		values.Set(k, v)
+	}
+	return values
+}
 
-	buf.WriteString("?")
-	buf.WriteString(values.Encode())
-	defer buf.Reset()
-	return buf.String()
+// viper 会将配置键转为小写, 还原驱动参数的大小写
+var driverParams = map[string]string{}
+
+func init() {
+	for _, name := range []string{
+		"allowAllFiles", "allowCleartextPasswords", "allowNativePasswords", "allowOldPasswords",
+		"charset", "checkConnLiveness", "clientFoundRows", "collation", "columnsWithAlias",
+		"interpolateParams", "loc", "maxAllowedPacket", "multiStatements", "parseTime",
+		"readTimeout", "rejectReadOnly", "serverPubKey", "timeout", "tls", "writeTimeout",
+	} {
+		driverParams[strings.ToLower(name)] = name
+	}
 }
 
+// 打开连接池, 密码可轮换或配置多主机时返回错误, 需使用 OpenPool 或 Configs.Init,
+// 否则 Go 1.17 之前关闭返回的连接池不会停止刷新密码及主库检查
 func (c Config) Open() (*sql.DB, error) {
-	db, err := sql.Open("mysql", c.String())
+	if c.passwordSource("").Dynamic() || len(c.Hosts) > 0 {
+		return nil, errors.New("password_file, password_provider and hosts need Config.OpenPool or Configs.Init")
+	}
+	return c.open("")
+}
+
+// 打开连接池, 返回的 closer 关闭连接池并停止刷新密码及主库检查, 失败时已关闭
+func (c Config) OpenPool() (db *sql.DB, closer func() error, err error) {
+	db, conn, err := c.openConnector("")
 	if err != nil {
-		return nil, err
+		if db != nil {
+			closePool(db, conn)
+		}
+		return nil, nil, err
+	}
+	return db, func() error { return closePool(db, conn) }, nil
+}
+
+// name 为连接名称, 用于语句日志
+func (c Config) open(name string) (*sql.DB, error) {
+	db, _, err := c.openConnector(name)
+	return db, err
+}
+
+func (c Config) openConnector(name string) (*sql.DB, *connector, error) {
+	if err := c.registerTLS(); err != nil {
+		return nil, nil, err
+	}
+	var db *sql.DB
+	var conn *connector
+	var err error
+	if c.plain(name) {
+		// 不需要包装时直接使用驱动
+		db, err = sql.Open(c.driverName(), c.String())
+	} else if conn, err = newConnector(name, c); err == nil {
+		db = sql.OpenDB(conn)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 	if c.MaxOpenConn == 0 {
 		c.MaxOpenConn = 20
@@ -104,5 +348,86 @@ func (c Config) Open() (*sql.DB, error) {
 	}
 	db.SetMaxOpenConns(c.MaxOpenConn)
 	db.SetMaxIdleConns(c.MaxIdleConn)
-	return db, db.Ping()
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+	return db, conn, db.Ping()
+}
+
+func (c Config) Validate() error {
+	if _, ok := getDriver(c.driverName()); !ok {
+		return fmt.Errorf("%s driver not found", c.driverName())
+	}
+	if c.Port != "" {
+		if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %q", c.Port)
+		}
+	}
+	if c.MaxOpenConn < 0 || c.MaxIdleConn < 0 {
+		return fmt.Errorf("MaxOpenConn and MaxIdleConn must not be negative")
+	}
+	if c.Timeout < 0 || c.ConnectTimeout < 0 || c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("conn_max_lifetime and conn_max_idle_time must not be negative")
+	}
+	if err := c.validateReplicas(); err != nil {
+		return err
+	}
+	if err := c.validateMode(); err != nil {
+		return err
+	}
+	if err := c.validateBreaker(); err != nil {
+		return err
+	}
+	if err := c.RetryPolicy.validate(); err != nil {
+		return err
+	}
+	if err := c.passwordSource("").Validate(); err != nil {
+		return err
+	}
+	if err := c.validateHosts(); err != nil {
+		return err
+	}
+	if err := c.validateSession(); err != nil {
+		return err
+	}
+	return c.validateTLS()
+}
+
+// 建立临时连接并 ping, 不注册到实例中
+func (c Config) Ping(ctx context.Context) error {
+	if err := c.registerTLS(); err != nil {
+		return err
+	}
+	if src := c.passwordSource(""); src.Dynamic() {
+		password, err := src.Read(ctx)
+		if err != nil {
+			return err
+		}
+		c.Password = password
+	}
+	if len(c.Hosts) > 0 {
+		// 任一候选主机可连接即可
+		var err error
+		for _, addr := range c.hostAddrs() {
+			if err = c.nodeConfig(addr).Ping(ctx); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+	db, err := sql.Open(c.driverName(), c.String())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// 通过连接器建立连接, 同时校验会话变量及初始化钩子
+	pinger := sql.OpenDB(&connector{name: "ping", config: c, driver: db.Driver()})
+	defer pinger.Close()
+	return pinger.PingContext(ctx)
 }
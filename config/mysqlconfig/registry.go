@@ -0,0 +1,270 @@
+package mysqlconfig
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	// 替换连接池后, 给已取得旧连接池的调用方留出发起查询的时间
+	drainGrace = time.Second
+)
+
+var (
+	instances = &registry{handles: map[string]*handle{}}
+)
+
+// 一个配置段对应的连接池
+type handle struct {
+	name   string
+	config Config
+	mu     sync.RWMutex
+	// 正在进行的连接, 并发调用共享其结果
+	connecting *connectCall
+	db         *sql.DB
+	conn       *connector
+	replicas   *replicaSet
+	failover   *failover
+	guard      *guard
+	err        error
+	stop       chan struct{}
+	once       sync.Once
+}
+
+type connectCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// 按连接模式创建连接池, 默认、strict 及 retry 模式返回首次连接的错误
+func openHandle(name string, c Config) (*handle, error) {
+	h := &handle{name: name, config: c, guard: newGuard(name, c), stop: make(chan struct{})}
+	switch c.mode() {
+	case ModeLazy:
+		return h, nil
+	case ModeRetry:
+		err := h.connect()
+		if err != nil {
+			go h.retry()
+		}
+		return h, err
+	default:
+		return h, h.connect()
+	}
+}
+
+// 建立连接, 已连接时直接返回, 正在连接时等待并返回其结果
+func (h *handle) connect() error {
+	h.mu.Lock()
+	if h.db != nil {
+		h.mu.Unlock()
+		return nil
+	}
+	if call := h.connecting; call != nil {
+		h.mu.Unlock()
+		call.wg.Wait()
+		return call.err
+	}
+	call := &connectCall{}
+	call.wg.Add(1)
+	h.connecting = call
+	h.mu.Unlock()
+
+	call.err = h.dial()
+	h.mu.Lock()
+	h.connecting = nil
+	h.mu.Unlock()
+	call.wg.Done()
+	return call.err
+}
+
+func (h *handle) dial() error {
+	db, conn, err := h.config.openConnector(h.name)
+	// 默认模式与未配置模式前一致, ping 失败时保留连接池, 由 database/sql 在使用时重新连接
+	if err != nil && (db == nil || h.config.mode() != ModeDefault) {
+		if db != nil {
+			closePool(db, conn)
+		}
+		h.mu.Lock()
+		h.err = err
+		h.mu.Unlock()
+		return err
+	}
+	var set *replicaSet
+	if len(h.config.Replicas) > 0 {
+		set = openReplicaSet(h.name, h.config)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.stop:
+		// 连接过程中已被关闭
+		if set != nil {
+			set.close()
+		}
+		closePool(db, conn)
+		return errClosed
+	default:
+	}
+	h.db, h.conn, h.replicas, h.err = db, conn, set, err
+	if conn != nil {
+		h.failover = conn.failover
+	}
+	return err
+}
+
+// 主库连接, lazy 模式首次获取时建立连接
+func (h *handle) get() (*sql.DB, error) {
+	h.mu.RLock()
+	db, err := h.db, h.err
+	h.mu.RUnlock()
+	if db != nil {
+		return db, nil
+	}
+	if h.config.mode() == ModeLazy {
+		if err = h.connect(); err == nil {
+			return h.get()
+		}
+	}
+	return nil, &NotReadyError{Name: h.name, Err: err}
+}
+
+func (h *handle) replicaSet() *replicaSet {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.replicas
+}
+
+func (h *handle) close() (err error) {
+	h.once.Do(func() {
+		close(h.stop)
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.replicas != nil {
+		h.replicas.close()
+	}
+	if h.db == nil {
+		return nil
+	}
+	if err = closePool(h.db, h.conn); err != nil {
+		log.Logger.Errorf("db [%s] close err:%s", h.name, err.Error())
+	}
+	return err
+}
+
+func (h *handle) inUse() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.db == nil {
+		return 0
+	}
+	return h.db.Stats().InUse
+}
+
+// 等待正在执行的查询结束后关闭, 超时强制关闭
+func (h *handle) drain() {
+	timeout := h.config.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	time.Sleep(drainGrace)
+	for h.inUse() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := h.inUse(); n > 0 {
+		log.Logger.Warnf("db [%s] drain timeout, %d connections still in use", h.name, n)
+	}
+	h.close()
+}
+
+type registry struct {
+	mu      sync.RWMutex
+	handles map[string]*handle
+}
+
+func (r *registry) get(name string) (*handle, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handles[name]
+	return h, ok
+}
+
+// 替换连接池, 返回旧的连接池
+func (r *registry) swap(name string, h *handle) *handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.handles[name]
+	r.handles[name] = h
+	return old
+}
+
+func (r *registry) remove(name string) *handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.handles[name]
+	delete(r.handles, name)
+	return h
+}
+
+func (r *registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handles))
+	for name := range r.handles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 移除全部连接池
+func (r *registry) reset() map[string]*handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handles := r.handles
+	r.handles = map[string]*handle{}
+	return handles
+}
+
+// 连接池状态
+type PoolStat struct {
+	Name string
+	// primary|replica
+	Role  string
+	Addr  string
+	Stats sql.DBStats
+}
+
+// 所有已连接的连接池状态
+func PoolStats() []PoolStat {
+	stats := make([]PoolStat, 0)
+	for _, name := range instances.names() {
+		h, ok := instances.get(name)
+		if !ok {
+			continue
+		}
+		h.mu.RLock()
+		if h.db != nil {
+			addr := h.config.addr()
+			if h.failover != nil {
+				addr, _ = h.failover.target()
+			}
+			stats = append(stats, PoolStat{Name: name, Role: "primary", Addr: addr, Stats: h.db.Stats()})
+		}
+		if h.replicas != nil {
+			for _, node := range h.replicas.nodes {
+				stats = append(stats, PoolStat{Name: name, Role: "replica", Addr: node.addr, Stats: node.db.Stats()})
+			}
+		}
+		h.mu.RUnlock()
+	}
+	return stats
+}
@@ -0,0 +1,133 @@
+package mysqlconfig
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/credential"
+)
+
+func TestConfigs_ChangeRemoved(t *testing.T) {
+	defer instances.reset()
+	kept := &handle{name: "kept", config: Config{Host: "kept"}, stop: make(chan struct{})}
+	instances.swap("kept", kept)
+	instances.swap("removed", &handle{name: "removed", stop: make(chan struct{})})
+
+	c := &Configs{"kept": Config{Host: "kept"}}
+	if err := c.Change(); err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	if h, ok := instances.get("kept"); !ok || h != kept {
+		t.Errorf("unchanged section should keep its handle")
+	}
+	if _, ok := instances.get("removed"); ok {
+		t.Errorf("removed section should be unregistered")
+	}
+	if names := Names(); len(names) != 1 || names[0] != "kept" {
+		t.Errorf("Names() = %v, want [kept]", names)
+	}
+}
+
+func TestConfigs_InitModes(t *testing.T) {
+	defer instances.reset()
+	// 无法连接的地址
+	unreachable := Config{Host: "127.0.0.1", Port: "1", ConnectTimeout: time.Second}
+
+	strict := unreachable
+	strict.Mode = ModeStrict
+	if err := (&Configs{"strict": strict}).Init(); err == nil {
+		t.Errorf("strict Init() expect error")
+	}
+	if _, ok := instances.get("strict"); ok {
+		t.Errorf("strict handle should not be registered on failure")
+	}
+
+	// 未配置模式时与之前一致, 保留未连接的连接池
+	if err := (&Configs{"default": unreachable}).Init(); err != nil {
+		t.Errorf("default Init() error = %v", err)
+	}
+	if db, err := Get("default"); err != nil || db == nil {
+		t.Errorf("Get(default) = %v, %v, want the unpinged pool", db, err)
+	}
+
+	lazy, retry := unreachable, unreachable
+	lazy.Mode, retry.Mode = ModeLazy, ModeRetry
+	retry.RetryInterval = time.Hour
+	if err := (&Configs{"lazy": lazy, "retry": retry}).Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	for _, name := range []string{"lazy", "retry"} {
+		if _, err := Get(name); !errors.Is(err, ErrNotReady) {
+			t.Errorf("Get(%s) error = %v, want ErrNotReady", name, err)
+		}
+	}
+	if err := (&Configs{}).Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestHandle_lazyConcurrentGet(t *testing.T) {
+	defer instances.reset()
+	// 建立连接耗时 100ms 后失败
+	var opens int32
+	fake.OnDial(func(dsn string) error {
+		atomic.AddInt32(&opens, 1)
+		time.Sleep(100 * time.Millisecond)
+		return errors.New("connection refused")
+	})
+	defer fake.Reset()
+	if err := (&Configs{"slow": Config{Driver: "toolkit-fake", Host: "slow", Mode: ModeLazy}}).Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	// 并发的 Get 共享同一次连接, 而不是依次等待各自的连接
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Get("slow"); !errors.Is(err, ErrNotReady) {
+				t.Errorf("Get() error = %v, want ErrNotReady", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if opens := atomic.LoadInt32(&opens); opens != 1 {
+		t.Errorf("opened %d connections, want 1", opens)
+	}
+	if cost := time.Since(start); cost > 300*time.Millisecond {
+		t.Errorf("concurrent Get took %s", cost)
+	}
+}
+
+func TestHandle_closeStopsCredentials(t *testing.T) {
+	var reads int32
+	credential.RegisterProvider("toolkit-close", func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&reads, 1)
+		return "secret", nil
+	})
+	c := Config{Driver: "toolkit-fake", Host: "close", PasswordProvider: "toolkit-close", PasswordRefresh: 5 * time.Millisecond}
+	c.Replicas = []Replica{{Host: "replica"}}
+	h, err := openHandle("close", c)
+	if err != nil {
+		t.Fatalf("openHandle() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&reads) < 2 {
+		t.Fatalf("password read %d times, want refreshes", reads)
+	}
+
+	// 不依赖 sql.DB 调用连接器的 Close, 主库及从库均停止刷新密码
+	h.close()
+	time.Sleep(10 * time.Millisecond)
+	closed := atomic.LoadInt32(&reads)
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&reads); n != closed {
+		t.Errorf("password read %d times after close", n-closed)
+	}
+}
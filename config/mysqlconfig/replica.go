@@ -0,0 +1,192 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+// 从库配置, 未设置的字段继承主库配置
+type Replica struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// 权重, 默认 1, 为 0 时不参与读请求
+	Weight *int
+}
+
+func (r Replica) weight() int {
+	if r.Weight == nil {
+		return 1
+	}
+	return *r.Weight
+}
+
+// 从库连接配置
+func (c Config) replicaConfig(r Replica) Config {
+	conf := c
+	conf.Replicas = nil
+	conf.Hosts = nil
+	conf.Host = r.Host
+	if r.Port != "" {
+		conf.Port = r.Port
+	}
+	if r.Username != "" {
+		conf.Username = r.Username
+	}
+	if r.Password != "" {
+		conf.Password = r.Password
+		conf.PasswordFile, conf.PasswordProvider = "", ""
+	}
+	return conf
+}
+
+// 读库连接, 没有可用从库时返回主库
+func GetReplica(dbHandler string) (*sql.DB, error) {
+	if h, ok := instances.get(dbHandler); ok {
+		if set := h.replicaSet(); set != nil {
+			if db := set.pick(); db != nil {
+				return db, nil
+			}
+		}
+	}
+	return Get(dbHandler)
+}
+
+type replica struct {
+	addr    string
+	db      *sql.DB
+	conn    *connector
+	weight  int
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) setHealthy(ok bool) (changed bool) {
+	var v int32
+	if ok {
+		v = 1
+	}
+	return atomic.SwapInt32(&r.healthy, v) != v
+}
+
+type replicaSet struct {
+	name     string
+	nodes    []*replica
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func openReplicaSet(name string, c Config) *replicaSet {
+	set := &replicaSet{
+		name:     name,
+		interval: c.HealthCheckInterval,
+		stop:     make(chan struct{}),
+	}
+	if set.interval <= 0 {
+		set.interval = 5 * time.Second
+	}
+	for _, r := range c.Replicas {
+		conf := c.replicaConfig(r)
+		db, conn, err := conf.openConnector(name)
+		if db == nil {
+			log.Logger.Errorf("db [%s] replica [%s] open conn err:%s", name, conf.addr(), err.Error())
+			continue
+		}
+		node := &replica{addr: conf.addr(), db: db, conn: conn, weight: r.weight()}
+		if err != nil {
+			log.Logger.Errorf("db [%s] replica [%s] open conn err:%s", name, node.addr, err.Error())
+		}
+		node.setHealthy(err == nil)
+		set.nodes = append(set.nodes, node)
+	}
+	go set.monitor()
+	return set
+}
+
+// 按权重随机选择健康的从库
+func (s *replicaSet) pick() *sql.DB {
+	total := 0
+	for _, node := range s.nodes {
+		if node.isHealthy() {
+			total += node.weight
+		}
+	}
+	if total <= 0 {
+		return nil
+	}
+	n := rand.Intn(total)
+	for _, node := range s.nodes {
+		if !node.isHealthy() {
+			continue
+		}
+		if n < node.weight {
+			return node.db
+		}
+		n -= node.weight
+	}
+	return nil
+}
+
+// 定时 ping 从库, 更新健康状态
+func (s *replicaSet) monitor() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+func (s *replicaSet) check() {
+	for _, node := range s.nodes {
+		ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+		err := node.db.PingContext(ctx)
+		cancel()
+		if node.setHealthy(err == nil) {
+			if err != nil {
+				log.Logger.Warnf("db [%s] replica [%s] unhealthy:%s", s.name, node.addr, err.Error())
+			} else {
+				log.Logger.Infof("db [%s] replica [%s] recovered", s.name, node.addr)
+			}
+		}
+	}
+}
+
+func (s *replicaSet) close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	for _, node := range s.nodes {
+		if err := closePool(node.db, node.conn); err != nil {
+			log.Logger.Errorf("db [%s] replica [%s] close err:%s", s.name, node.addr, err.Error())
+		}
+	}
+}
+
+func (c Config) validateReplicas() error {
+	for i, r := range c.Replicas {
+		if r.Host == "" {
+			return fmt.Errorf("replicas[%d] host is required", i)
+		}
+		if r.weight() < 0 {
+			return fmt.Errorf("replicas[%d] weight must not be negative", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package mysqlconfig
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestReplicaSet_pick(t *testing.T) {
+	a, b, c := &sql.DB{}, &sql.DB{}, &sql.DB{}
+	set := &replicaSet{nodes: []*replica{
+		{addr: "a", db: a, weight: 1},
+		{addr: "b", db: b, weight: 0, healthy: 1},
+		{addr: "c", db: c, weight: 3, healthy: 1},
+	}}
+	for i := 0; i < 100; i++ {
+		if got := set.pick(); got != c {
+			t.Fatalf("pick() = %p, want healthy weighted replica %p", got, c)
+		}
+	}
+	set.nodes[2].setHealthy(false)
+	if got := set.pick(); got != nil {
+		t.Errorf("pick() = %p, want nil when no replica available", got)
+	}
+}
+
+func TestConfig_replicaConfig(t *testing.T) {
+	primary := Config{Host: "primary", Port: "3307", DB: "dbname", Username: "root", Password: "1234"}
+	got := primary.replicaConfig(Replica{Host: "replica", Username: "reader"})
+	want := "reader:1234@(replica:3307)/dbname?charset=utf8mb4&loc=Local&parseTime=True"
+	if got.String() != want {
+		t.Errorf("replicaConfig() = %v, want %v", got.String(), want)
+	}
+}
@@ -0,0 +1,113 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultRetryMaxBackoff = time.Second
+)
+
+// deadlock, lock wait timeout
+var defaultRetryCodes = []uint16{1213, 1205}
+
+// 临时错误重试策略, max_attempts 不大于 1 时不重试
+type RetryPolicy struct {
+	// 最多执行次数, 包含首次执行
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// 首次重试前的等待时间, 之后按指数增长并加入随机抖动, 默认 50ms
+	Backoff    time.Duration
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// 重试的 mysql 错误码, 默认 1213, 1205
+	Codes []uint16
+	// 连接断开(driver.ErrBadConn)时重试, Retry 只用于只读查询及提交前失败的整个事务
+	BadConn bool `mapstructure:"bad_conn"`
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry_policy options must not be negative")
+	}
+	return nil
+}
+
+// 是否为可重试的临时错误, 重试配置的错误码, 开启 bad_conn 时重试连接断开
+// 提交过程中的错误可能已在服务端生效, 不重试
+func (p RetryPolicy) transient(err error) bool {
+	var ce *commitError
+	if errors.As(err, &ce) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return p.BadConn
+	}
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+	codes := p.Codes
+	if len(codes) == 0 {
+		codes = defaultRetryCodes
+	}
+	for _, code := range codes {
+		if myErr.Number == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 第 attempt 次重试前的等待时间, 在 [d/2, d] 之间随机
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base, max := p.Backoff, p.MaxBackoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p RetryPolicy) do(ctx context.Context, name string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.transient(err) {
+			return err
+		}
+		wait := p.backoff(attempt)
+		log.Logger.Warnf("db [%s] transient error, retry %d/%d after %s: %s", name, attempt, p.MaxAttempts-1, wait, err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// 按连接的重试策略执行 fn, fn 必须可整体重复执行, 如只读查询或完整的事务
+func Retry(ctx context.Context, dbHandler string, fn func() error) error {
+	h, ok := instances.get(dbHandler)
+	if !ok || h.config.RetryPolicy.MaxAttempts <= 1 {
+		return fn()
+	}
+	return h.config.RetryPolicy.do(ctx, dbHandler, fn)
+}
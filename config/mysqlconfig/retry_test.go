@@ -0,0 +1,84 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestRetryPolicy_Transient(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		err    error
+		want   bool
+	}{
+		{"deadlock", RetryPolicy{}, deadlock, true},
+		{"wrapped", RetryPolicy{}, fmt.Errorf("query: %w", deadlock), true},
+		{"lock wait", RetryPolicy{}, &mysql.MySQLError{Number: 1205}, true},
+		{"bad conn", RetryPolicy{}, driver.ErrBadConn, false},
+		{"bad conn enabled", RetryPolicy{BadConn: true}, fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{"bad conn on commit", RetryPolicy{BadConn: true}, &commitError{err: driver.ErrBadConn}, false},
+		{"invalid conn", RetryPolicy{}, mysql.ErrInvalidConn, false},
+		{"commit", RetryPolicy{}, &commitError{err: deadlock}, false},
+		{"duplicate", RetryPolicy{}, &mysql.MySQLError{Number: 1062}, false},
+		{"custom codes", RetryPolicy{Codes: []uint16{1062}}, deadlock, false},
+		{"other", RetryPolicy{}, errors.New("syntax"), false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.transient(tt.err); got != tt.want {
+			t.Errorf("%s: transient() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	bounds := map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 10: 40 * time.Millisecond}
+	for attempt, max := range bounds {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt); d < max/2 || d > max {
+				t.Fatalf("backoff(%d) = %s, want [%s, %s]", attempt, d, max/2, max)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	calls := 0
+	err := p.do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return &mysql.MySQLError{Number: 1213}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("do() = %v after %d calls, want nil after 3", err, calls)
+	}
+
+	calls = 0
+	err = p.do(context.Background(), "test", func() error {
+		calls++
+		return &mysql.MySQLError{Number: 1213}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("do() = %v after %d calls, want error after 3", err, calls)
+	}
+
+	calls = 0
+	p.do(context.Background(), "test", func() error {
+		calls++
+		return errors.New("syntax")
+	})
+	if calls != 1 {
+		t.Errorf("do() non transient error called %d times, want 1", calls)
+	}
+}
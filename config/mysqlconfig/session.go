@@ -0,0 +1,159 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 连接初始化钩子, 在每个新建的物理连接上执行, 返回错误时丢弃该连接
+type InitHook func(ctx context.Context, name string, conn *SessionConn) error
+
+var (
+	initHooks  = map[string]InitHook{}
+	initHookMu sync.RWMutex
+
+	sessionVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+// 注册初始化钩子, 配置中通过 init_hook 引用
+func RegisterInitHook(name string, hook InitHook) {
+	initHookMu.Lock()
+	defer initHookMu.Unlock()
+	initHooks[name] = hook
+}
+
+func getInitHook(name string) (InitHook, bool) {
+	initHookMu.RLock()
+	defer initHookMu.RUnlock()
+	hook, ok := initHooks[name]
+	return hook, ok
+}
+
+// 新建的物理连接
+type SessionConn struct {
+	conn    driver.Conn
+	dialect string
+}
+
+// 连接的 sql 方言
+func (c *SessionConn) Dialect() string {
+	return c.dialect
+}
+
+// 驱动的原始连接
+func (c *SessionConn) Raw() driver.Conn {
+	return c.conn
+}
+
+// 在连接上执行语句
+func (c *SessionConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return err
+		}
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		if _, err := execer.ExecContext(ctx, query, named); err != driver.ErrSkip {
+			return err
+		}
+	}
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if execer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = execer.ExecContext(ctx, named)
+		return err
+	}
+	values, err := driverValues(named)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(values)
+	return err
+}
+
+func (c Config) validateSession() error {
+	for name := range c.SessionVars {
+		if !sessionVarName.MatchString(name) {
+			return fmt.Errorf("invalid session variable %q", name)
+		}
+	}
+	if c.InitHook != "" {
+		if _, ok := getInitHook(c.InitHook); !ok {
+			return fmt.Errorf("init hook %q not registered", c.InitHook)
+		}
+	}
+	return nil
+}
+
+// 会话变量的值, 数值及 ON、OFF 等关键字原样使用, 其他作为字符串
+func sessionValue(v string) string {
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v
+	}
+	switch strings.ToUpper(v) {
+	case "ON", "OFF", "TRUE", "FALSE", "DEFAULT":
+		return v
+	}
+	return "'" + strings.Replace(strings.Replace(v, `\`, `\\`, -1), "'", "''", -1) + "'"
+}
+
+// 建立连接后执行的语句, 会话变量按名称排序, 之后为 init_sql
+func (c Config) sessionStatements() []string {
+	names := make([]string, 0, len(c.SessionVars))
+	for name := range c.SessionVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stmts := make([]string, 0, len(names)+len(c.InitSQL))
+	for _, name := range names {
+		value := sessionValue(c.SessionVars[name])
+		if c.Dialect() == DialectSQLite {
+			stmts = append(stmts, fmt.Sprintf("PRAGMA %s = %s", name, value))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("SET SESSION %s = %s", name, value))
+		}
+	}
+	return append(stmts, c.InitSQL...)
+}
+
+// 初始化新建的物理连接
+func (c Config) initConn(ctx context.Context, name string, conn driver.Conn) error {
+	if len(c.SessionVars) == 0 && len(c.InitSQL) == 0 && c.InitHook == "" {
+		return nil
+	}
+	session := &SessionConn{conn: conn, dialect: c.Dialect()}
+	for _, stmt := range c.sessionStatements() {
+		if err := session.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("db [%s] init connection %q: %w", name, stmt, err)
+		}
+	}
+	if c.InitHook == "" {
+		return nil
+	}
+	hook, ok := getInitHook(c.InitHook)
+	if !ok {
+		return fmt.Errorf("db [%s] init hook %q not registered", name, c.InitHook)
+	}
+	if err := hook(ctx, name, session); err != nil {
+		return fmt.Errorf("db [%s] init hook %q: %w", name, c.InitHook, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package mysqlconfig
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSessionValue(t *testing.T) {
+	tests := map[string]string{
+		"+00:00":         "'+00:00'",
+		"28800":          "28800",
+		"off":            "off",
+		"it's":           "'it''s'",
+		`a\b`:            `'a\\b'`,
+		"0.5":            "0.5",
+		"READ-COMMITTED": "'READ-COMMITTED'",
+	}
+	for in, want := range tests {
+		if got := sessionValue(in); got != want {
+			t.Errorf("sessionValue(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestConfig_OpenInitConn(t *testing.T) {
+	var hooked []string
+	RegisterInitHook("test-init", func(ctx context.Context, name string, conn *SessionConn) error {
+		hooked = append(hooked, name)
+		return conn.Exec(ctx, "SET @app = ?", "toolkit")
+	})
+	c := Config{
+		Driver:      "toolkit-fake",
+		Host:        "init",
+		SessionVars: map[string]string{"time_zone": "+00:00", "sql_mode": "STRICT_ALL_TABLES"},
+		InitSQL:     []string{"SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED"},
+		InitHook:    "test-init",
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	fake.Reset()
+
+	db, err := c.open("init")
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	defer db.Close()
+	want := []string{
+		"SET SESSION sql_mode = 'STRICT_ALL_TABLES'",
+		"SET SESSION time_zone = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED",
+		"SET @app = ?",
+	}
+	got := fake.Queries()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("queries = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(hooked, []string{"init"}) {
+		t.Errorf("hook called with %v", hooked)
+	}
+
+	// 初始化失败时 Open 返回错误
+	errInit := errors.New("init failed")
+	RegisterInitHook("test-fail", func(ctx context.Context, name string, conn *SessionConn) error {
+		return errInit
+	})
+	c.InitHook = "test-fail"
+	if db, err := c.Open(); !errors.Is(err, errInit) {
+		t.Errorf("Open() error = %v, want %v", err, errInit)
+	} else {
+		db.Close()
+	}
+
+	c.InitHook = "missing"
+	if err := c.Validate(); err == nil {
+		t.Error("Validate() accepted unregistered init hook")
+	}
+	c.InitHook, c.SessionVars = "", map[string]string{"x; DROP": "1"}
+	if err := c.Validate(); err == nil {
+		t.Error("Validate() accepted invalid session variable name")
+	}
+}
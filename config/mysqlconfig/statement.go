@@ -0,0 +1,126 @@
+package mysqlconfig
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/logconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+// 语句日志及统计的钩子, 由 db 包注册
+type StatementHooks interface {
+	// 替换参数后的语句指纹
+	Fingerprint(query string) string
+	// 脱敏后的参数
+	MaskArgs(args []interface{}) []string
+	// 开启 query_stats 时记录语句耗时
+	Record(handle string, query string, cost time.Duration, err error)
+}
+
+var (
+	statementHooks   StatementHooks = noopHooks{}
+	statementHooksMu sync.RWMutex
+)
+
+// 注册语句钩子, 未注册时日志记录原始语句且不记录参数, 不统计耗时
+func RegisterStatementHooks(hooks StatementHooks) {
+	statementHooksMu.Lock()
+	defer statementHooksMu.Unlock()
+	statementHooks = hooks
+}
+
+func getStatementHooks() StatementHooks {
+	statementHooksMu.RLock()
+	defer statementHooksMu.RUnlock()
+	return statementHooks
+}
+
+type noopHooks struct{}
+
+func (noopHooks) Fingerprint(query string) string {
+	return query
+}
+
+func (noopHooks) MaskArgs(args []interface{}) []string {
+	return nil
+}
+
+func (noopHooks) Record(handle string, query string, cost time.Duration, err error) {}
+
+// 执行的语句
+type Statement struct {
+	Table string
+	Query string
+	Args  []interface{}
+	// 影响或返回的行数, 未知时为 -1
+	Rows int64
+	Cost time.Duration
+	Err  error
+}
+
+type tableCtxKey struct{}
+
+// 记录语句所属的表, 用于日志
+func WithTable(ctx context.Context, table string) context.Context {
+	return context.WithValue(ctx, tableCtxKey{}, table)
+}
+
+func tableFromContext(ctx context.Context) string {
+	table, _ := ctx.Value(tableCtxKey{}).(string)
+	return table
+}
+
+// 记录 SQLDao 执行的语句, 开启 trace_driver 时由驱动包装层记录
+func Observe(ctx context.Context, dbHandler string, st Statement) {
+	h, ok := instances.get(dbHandler)
+	if !ok || h.config.TraceDriver {
+		return
+	}
+	observe(ctx, dbHandler, h.config, st)
+}
+
+func observe(ctx context.Context, name string, c Config, st Statement) {
+	hooks := getStatementHooks()
+	if c.QueryStats {
+		hooks.Record(name, st.Query, st.Cost, st.Err)
+	}
+	slow := c.SlowThreshold > 0 && st.Cost >= c.SlowThreshold
+	if !slow && !c.LogStatements {
+		return
+	}
+	if st.Table == "" {
+		st.Table = tableFromContext(ctx)
+	}
+	fields := map[string]interface{}{
+		"handle":      name,
+		"table":       st.Table,
+		"fingerprint": hooks.Fingerprint(st.Query),
+		"args":        hooks.MaskArgs(st.Args),
+		"cost_ms":     float64(st.Cost.Microseconds()) / 1000,
+		log.RequestID: log.GetContextRequestID(),
+	}
+	if st.Rows >= 0 {
+		fields["rows"] = st.Rows
+	}
+	logger := c.logger().WithFields(fields)
+	if st.Err != nil {
+		logger = logger.WithError(st.Err)
+	}
+	if slow {
+		logger.Warnf("slow sql, cost %s over %s", st.Cost, c.SlowThreshold)
+	} else {
+		logger.Debug("sql")
+	}
+}
+
+// 语句日志, 未配置或未找到时使用默认日志
+func (c Config) logger() log.FieldLogger {
+	if c.Logger != "" {
+		if logger, err := logconfig.Get(c.Logger); err == nil {
+			return logger
+		}
+	}
+	return log.Logger
+}
@@ -0,0 +1,100 @@
+package mysqlconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var tlsModes = map[string]bool{
+	"":            true,
+	"false":       true,
+	"true":        true,
+	"skip-verify": true,
+	"preferred":   true,
+}
+
+// 是否需要注册自定义 tls 配置
+func (c Config) customTLS() bool {
+	return c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != ""
+}
+
+// 自定义 tls 配置名称, 相同证书配置得到相同名称
+func (c Config) tlsName() string {
+	h := fnv.New64a()
+	for _, s := range []string{c.TLS, c.TLSCA, c.TLSCert, c.TLSKey, c.TLSServerName} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("toolkit-%x", h.Sum64())
+}
+
+// dsn 中 tls 参数
+func (c Config) tlsParam() string {
+	mode := strings.ToLower(c.TLS)
+	if mode == "false" {
+		return ""
+	}
+	if c.customTLS() {
+		return c.tlsName()
+	}
+	return mode
+}
+
+func (c Config) validateTLS() error {
+	if !tlsModes[strings.ToLower(c.TLS)] {
+		return fmt.Errorf("unknown tls mode %q", c.TLS)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	return nil
+}
+
+// 注册自定义 tls 配置到 mysql 驱动
+func (c Config) registerTLS() error {
+	if !c.customTLS() || strings.ToLower(c.TLS) == "false" || c.Dialect() != DialectMySQL {
+		return nil
+	}
+	conf, err := c.tlsConfig()
+	if err != nil {
+		return err
+	}
+	return mysql.RegisterTLSConfig(c.tlsName(), conf)
+}
+
+// 自定义 tls 配置, 未配置 tls_server_name 时由驱动按连接的地址校验证书,
+// 相同证书的配置段、从库及多主机节点共用同一名称
+func (c Config) tlsConfig() (*tls.Config, error) {
+	if err := c.validateTLS(); err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: strings.ToLower(c.TLS) == "skip-verify",
+	}
+	if c.TLSCA != "" {
+		pem, err := ioutil.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.TLSCA)
+		}
+		conf.RootCAs = pool
+	}
+	if c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
@@ -0,0 +1,140 @@
+package mysqlconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试 CA, 签发指定主机名的服务端证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "toolkit test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	file := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// 使用 host 证书的 tls 服务, 返回监听地址
+func (ca *testCA) serve(t *testing.T, host string) net.Listener {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return l
+}
+
+// 与驱动相同, 未指定 ServerName 时使用连接的主机名校验证书
+func handshake(conf *tls.Config, host string, l net.Listener) error {
+	conf = conf.Clone()
+	if conf.ServerName == "" && !conf.InsecureSkipVerify {
+		conf.ServerName = host
+	}
+	conn, err := tls.Dial("tcp", l.Addr().String(), conf)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestConfig_tlsConfigSharedAcrossHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+
+	a := Config{Host: "db1.local", TLS: "true", TLSCA: ca.file}
+	b := Config{Host: "db2.local", TLS: "true", TLSCA: ca.file}
+	if a.tlsName() != b.tlsName() {
+		t.Fatalf("tlsName() differs for same certificates")
+	}
+	conf, err := a.tlsConfig()
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	if conf.ServerName != "" {
+		t.Errorf("ServerName = %q, want empty so the driver uses the dialed host", conf.ServerName)
+	}
+	for _, host := range []string{a.Host, b.Host} {
+		l := ca.serve(t, host)
+		if err := handshake(conf, host, l); err != nil {
+			t.Errorf("handshake(%s) error = %v", host, err)
+		}
+		l.Close()
+	}
+
+	named := a
+	named.TLSServerName = "proxy.local"
+	if conf, _ := named.tlsConfig(); conf.ServerName != "proxy.local" {
+		t.Errorf("ServerName = %q, want proxy.local", conf.ServerName)
+	}
+	if named.tlsName() == a.tlsName() {
+		t.Errorf("tlsName() should differ when tls_server_name differs")
+	}
+}
@@ -0,0 +1,140 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// BeginTx 开启的事务, 持有 AfterCommit 注册的函数, 直接调用 Commit/Rollback 即可执行或丢弃这些函数
+type Tx struct {
+	*sql.Tx
+	mu       sync.Mutex
+	hooks    []func()
+	finished bool
+	done     chan struct{}
+}
+
+var (
+	// 事务到 Tx 的登记, 用于只持有 *sql.Tx 时注册提交后的函数, 事务结束或 ctx 结束时删除
+	txs   = map[*sql.Tx]*Tx{}
+	txsMu sync.Mutex
+)
+
+// 开启可注册 AfterCommit 的事务, 需通过返回值的 Commit 提交或 Rollback 回滚, utils.Transaction 已处理
+// ctx 结束时 database/sql 回滚事务, 同时丢弃注册的函数
+func BeginTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*Tx, error) {
+	stx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	tx := &Tx{Tx: stx, done: make(chan struct{})}
+	txsMu.Lock()
+	txs[stx] = tx
+	txsMu.Unlock()
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				tx.finish()
+			case <-tx.done:
+			}
+		}()
+	}
+	return tx, nil
+}
+
+func lookupTx(tx *sql.Tx) (*Tx, bool) {
+	txsMu.Lock()
+	defer txsMu.Unlock()
+	t, ok := txs[tx]
+	return t, ok
+}
+
+// 结束事务的登记, 返回注册的函数, 只有第一次调用返回
+func (tx *Tx) finish() []func() {
+	tx.mu.Lock()
+	if tx.finished {
+		tx.mu.Unlock()
+		return nil
+	}
+	hooks := tx.hooks
+	tx.hooks, tx.finished = nil, true
+	tx.mu.Unlock()
+
+	txsMu.Lock()
+	delete(txs, tx.Tx)
+	txsMu.Unlock()
+	close(tx.done)
+	return hooks
+}
+
+// 注册事务提交成功后执行的函数, 事务已结束时不注册并返回 false
+func (tx *Tx) AfterCommit(fn func()) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.finished {
+		return false
+	}
+	tx.hooks = append(tx.hooks, fn)
+	return true
+}
+
+// 提交事务, 成功后按注册顺序执行 AfterCommit 注册的函数, 提交失败时的错误不会被 Retry 重试
+func (tx *Tx) Commit() error {
+	hooks := tx.finish()
+	if err := tx.Tx.Commit(); err != nil {
+		return &commitError{err: err}
+	}
+	for _, fn := range hooks {
+		fn()
+	}
+	return nil
+}
+
+// 回滚事务, 丢弃 AfterCommit 注册的函数
+func (tx *Tx) Rollback() error {
+	tx.finish()
+	return tx.Tx.Rollback()
+}
+
+// 注册事务提交成功后执行的函数, 事务不是由 BeginTx 开启或已结束时不注册并返回 false
+func AfterCommit(tx *sql.Tx, fn func()) bool {
+	t, ok := lookupTx(tx)
+	if !ok {
+		return false
+	}
+	return t.AfterCommit(fn)
+}
+
+// 提交过程中的错误, 事务可能已在服务端提交, 不能重试
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+// 提交只持有 *sql.Tx 的事务, 由 BeginTx 开启时同 Tx.Commit
+func Commit(tx *sql.Tx) error {
+	if t, ok := lookupTx(tx); ok {
+		return t.Commit()
+	}
+	if err := tx.Commit(); err != nil {
+		return &commitError{err: err}
+	}
+	return nil
+}
+
+// 回滚只持有 *sql.Tx 的事务, 由 BeginTx 开启时同 Tx.Rollback
+func Rollback(tx *sql.Tx) error {
+	if t, ok := lookupTx(tx); ok {
+		return t.Rollback()
+	}
+	return tx.Rollback()
+}
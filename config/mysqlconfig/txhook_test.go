@@ -0,0 +1,128 @@
+package mysqlconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func txCount() int {
+	txsMu.Lock()
+	defer txsMu.Unlock()
+	return len(txs)
+}
+
+func TestCommit_hooks(t *testing.T) {
+	db, err := sql.Open("toolkit-fake", "txhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var calls []string
+	plain, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 非 BeginTx 开启的事务不注册
+	if AfterCommit(plain, func() { calls = append(calls, "plain") }) {
+		t.Error("AfterCommit() registered on a plain tx")
+	}
+	if err := Commit(plain); err != nil || len(calls) != 0 {
+		t.Fatalf("plain tx: Commit() = %v, calls = %v", err, calls)
+	}
+
+	tx, err := BeginTx(context.Background(), db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AfterCommit(tx.Tx, func() { calls = append(calls, "a") })
+	tx.AfterCommit(func() { calls = append(calls, "b") })
+	if len(calls) != 0 {
+		t.Fatalf("hooks ran before commit: %v", calls)
+	}
+	// 直接调用返回值的 Commit
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "a" || calls[1] != "b" {
+		t.Errorf("calls = %v, want [a b]", calls)
+	}
+	if tx.AfterCommit(func() { calls = append(calls, "late") }) || AfterCommit(tx.Tx, func() {}) {
+		t.Error("AfterCommit() registered on a finished tx")
+	}
+	// 重复提交返回错误且不再执行
+	if err := Commit(tx.Tx); !errors.Is(err, sql.ErrTxDone) || len(calls) != 2 {
+		t.Errorf("second Commit() = %v, calls = %v", err, calls)
+	}
+
+	tx, err = BeginTx(context.Background(), db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.AfterCommit(func() { calls = append(calls, "rollback") })
+	if err := Rollback(tx.Tx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("Commit() after rollback error = %v, want ErrTxDone", err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("hook ran after rollback: %v", calls)
+	}
+	if n := txCount(); n != 0 {
+		t.Errorf("txs = %d entries, want 0", n)
+	}
+}
+
+// ctx 结束时 database/sql 回滚事务, 登记随之删除, 之后的提交返回错误且不执行注册的函数
+func TestBeginTx_contextDone(t *testing.T) {
+	db, err := sql.Open("toolkit-fake", "txhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := false
+	tx.AfterCommit(func() { called = true })
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for txCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := txCount(); n != 0 {
+		t.Fatalf("txs = %d entries after cancel, want 0", n)
+	}
+	if err := tx.Commit(); err == nil || called {
+		t.Errorf("Commit() after cancel = %v, hook called %v", err, called)
+	}
+}
+
+func TestCommit_errorNotRetried(t *testing.T) {
+	db, err := sql.Open("toolkit-fake", "txhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	err = Commit(tx)
+	if !errors.Is(err, sql.ErrTxDone) {
+		t.Fatalf("Commit() error = %v, want ErrTxDone", err)
+	}
+	p := RetryPolicy{MaxAttempts: 3, Codes: []uint16{1213}}
+	if p.transient(err) {
+		t.Error("commit error should not be transient")
+	}
+}
@@ -0,0 +1,167 @@
+package redisconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	// 初始化时 ping, 失败则初始化失败
+	InitStrict = "strict"
+	// 初始化时不等待连接, 由后台检查报告连接状态, 默认
+	InitLazy = "lazy"
+
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultPingTimeout         = 5 * time.Second
+)
+
+func (c *Config) initMode() string {
+	if c.InitMode == "" {
+		return InitLazy
+	}
+	return strings.ToLower(c.InitMode)
+}
+
+func (c *Config) validateHealth() error {
+	switch c.initMode() {
+	case InitStrict, InitLazy:
+	default:
+		return fmt.Errorf("unknown init_mode %q", c.InitMode)
+	}
+	if c.HealthCheckInterval < -1 {
+		return fmt.Errorf("health_check_interval must not be negative except -1")
+	}
+	return nil
+}
+
+// 后台检查间隔, 为 0 时关闭
+func (c *Config) healthCheckInterval() time.Duration {
+	switch {
+	case c.HealthCheckInterval < 0:
+		return 0
+	case c.HealthCheckInterval == 0:
+		return defaultHealthCheckInterval
+	}
+	return c.HealthCheckInterval
+}
+
+// 定时 ping 并在连接断开及恢复时输出日志
+type monitor struct {
+	name     string
+	client   redis.UniversalClient
+	interval time.Duration
+	mu       sync.RWMutex
+	logger   log.FieldLogger
+	checked  bool
+	err      error
+	started  bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newMonitor(name string, client redis.UniversalClient, interval time.Duration) *monitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &monitor{
+		name:     name,
+		client:   client,
+		interval: interval,
+		logger:   log.Logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *monitor) check() error {
+	timeout := m.interval
+	if timeout <= 0 || timeout > defaultPingTimeout {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, timeout)
+	defer cancel()
+	err := m.client.Ping(ctx).Err()
+	if m.ctx.Err() != nil {
+		// 已关闭, 不再记录结果
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err != nil && (m.err == nil || !m.checked):
+		m.logger.Warnf("redis [%s] unreachable: %s", m.name, err.Error())
+	case err == nil && m.err != nil:
+		m.logger.Infof("redis [%s] reconnected", m.name)
+	}
+	m.checked, m.err = true, err
+	return err
+}
+
+// 启动后台检查, immediate 为 true 时立即检查一次
+func (m *monitor) start(immediate bool) {
+	m.mu.Lock()
+	m.started = true
+	m.mu.Unlock()
+	go func() {
+		defer close(m.done)
+		m.run(immediate)
+	}()
+}
+
+func (m *monitor) run(immediate bool) {
+	if immediate {
+		m.check()
+	}
+	if m.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *monitor) health() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+// 停止后台检查, 取消进行中的 ping 并等待检查结束
+func (m *monitor) close() {
+	m.once.Do(func() {
+		m.cancel()
+		close(m.stop)
+	})
+	m.mu.RLock()
+	started := m.started
+	m.mu.RUnlock()
+	if started {
+		<-m.done
+	}
+}
+
+// 最近一次后台检查的结果, 尚未检查或关闭检查时返回 nil
+func Health(name string) error {
+	h, ok := instances.get(name)
+	if !ok {
+		return fmt.Errorf("%s redis not found", name)
+	}
+	return h.monitor.health()
+}
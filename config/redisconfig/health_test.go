@@ -0,0 +1,71 @@
+package redisconfig
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+func TestConfigs_InitStrict(t *testing.T) {
+	r := miniredis.RunT(t)
+	addr := r.Addr()
+	r.Close()
+
+	strict := Configs{"down": &Config{Addr: addr, InitMode: InitStrict, DialTimeout: 100 * time.Millisecond, MaxRetries: -1}}
+	err := strict.Init()
+	if err == nil || !strings.Contains(err.Error(), "redis [down] ping") {
+		t.Errorf("Init() error = %v, want ping error", err)
+	}
+	if err := strict.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := Get("down"); err == nil {
+		t.Error("Get() after Close() returned client")
+	}
+}
+
+func TestMonitor_Reconnect(t *testing.T) {
+	r := miniredis.RunT(t)
+	addr := r.Addr()
+	r.Close()
+
+	lazy := Configs{"cache": &Config{Addr: addr, DialTimeout: 100 * time.Millisecond, MaxRetries: -1, HealthCheckInterval: -1}}
+	if err := lazy.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer lazy.Close()
+	h, _ := instances.get("cache")
+	m := h.monitor
+	// 等待初始化时的检查结束, 只替换该检查的日志, 不影响其他 goroutine
+	<-m.done
+	var buf bytes.Buffer
+	m.mu.Lock()
+	m.logger = log.NewZapLogger("json", false, "debug", &buf)
+	m.checked = false
+	m.mu.Unlock()
+	if err := m.check(); err == nil {
+		t.Fatal("check() error = nil, want connection error")
+	}
+	if err := Health("cache"); err == nil {
+		t.Error("Health() error = nil while unreachable")
+	}
+
+	if err := r.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.check(); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if err := Health("cache"); err != nil {
+		t.Errorf("Health() error = %v", err)
+	}
+	for _, want := range []string{"redis [cache] unreachable", "redis [cache] reconnected"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %s does not contain %s", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package redisconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// 单节点, 默认
+	ModeStandalone = "standalone"
+	// 通过 sentinel 发现主节点
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+var errClusterClient = errors.New("cluster mode has no *redis.Client, use Get or NewUniversalClient")
+
+func (c *Config) mode() string {
+	if c.Mode == "" {
+		return ModeStandalone
+	}
+	return strings.ToLower(c.Mode)
+}
+
+// 节点地址, sentinel 为 sentinel 节点, cluster 为种子节点, 未配置 addrs 时使用 addr
+func (c *Config) addrs() []string {
+	if len(c.Addrs) > 0 {
+		return c.Addrs
+	}
+	if c.Addr != "" {
+		return []string{c.Addr}
+	}
+	if c.mode() == ModeStandalone {
+		return []string{defaultAddr}
+	}
+	return nil
+}
+
+func (c *Config) validateMode() error {
+	switch c.mode() {
+	case ModeStandalone:
+		if len(c.Addrs) > 0 {
+			return fmt.Errorf("addrs requires sentinel or cluster mode")
+		}
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return fmt.Errorf("master_name is required in sentinel mode")
+		}
+		if c.passwordSource("").Dynamic() {
+			// 轮换密码的认证也会发送到 sentinel 节点
+			return fmt.Errorf("password_file and password_provider are not supported in sentinel mode")
+		}
+	case ModeCluster:
+		if c.DB != 0 {
+			return fmt.Errorf("db must be 0 in cluster mode")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	if c.MaxRedirects < -1 {
+		return fmt.Errorf("invalid max_redirects %d", c.MaxRedirects)
+	}
+	if c.Network == "unix" {
+		return nil
+	}
+	for _, addr := range c.addrs() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid addr %q: %s", addr, err.Error())
+		}
+	}
+	return nil
+}
+
+// 按 mode 创建客户端
+func (c *Config) build(opt *redis.UniversalOptions) redis.UniversalClient {
+	switch c.mode() {
+	case ModeSentinel:
+		return redis.NewFailoverClient(opt.Failover())
+	case ModeCluster:
+		return redis.NewClusterClient(opt.Cluster())
+	}
+	simple := opt.Simple()
+	simple.Network = c.Network
+	return redis.NewClient(simple)
+}
+
+// 配置错误时返回的客户端所有命令均返回该错误
+func failingDialer(err error) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, err
+	}
+}
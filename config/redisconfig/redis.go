@@ -1,33 +1,232 @@
 package redisconfig
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-redis/redis/v8"
+	"github.com/zhouchang2017/toolkit/config"
+	"github.com/zhouchang2017/toolkit/config/credential"
 	"github.com/zhouchang2017/toolkit/log"
-)
-
-var (
-	instance = map[string]*redis.Client{}
+	"reflect"
+	"sort"
+	"time"
 )
 
 type Configs map[string]*Config
 
+const (
+	defaultAddr        = "localhost:6379"
+	defaultDialTimeout = 5 * time.Second
+	defaultReadTimeout = 3 * time.Second
+	defaultMaxRetries  = 3
+)
+
+// 超时及重试选项为 -1 时关闭
 type Config struct {
-	Addr     string
+	// standalone|sentinel|cluster, 默认 standalone
+	Mode string
+	// tcp|unix, 默认 tcp, 仅 standalone
+	Network string
+	Addr    string
+	// sentinel 节点或 cluster 种子节点, 未配置时使用 addr
+	Addrs []string
+	// sentinel 监控的主节点名称
+	MasterName       string `mapstructure:"master_name"`
+	SentinelPassword string `mapstructure:"sentinel_password"`
+	// cluster 选项, read_only 时只读命令发送到从节点
+	MaxRedirects   int  `mapstructure:"max_redirects"`
+	ReadOnly       bool `mapstructure:"read_only"`
+	RouteByLatency bool `mapstructure:"route_by_latency"`
+	RouteRandomly  bool `mapstructure:"route_randomly"`
+	// redis 6 ACL 用户名
+	Username string
 	Password string
-	DB       int
+	// 从文件或注册的 provider 读取密码, 定时或文件变化时重新读取, 新建的连接使用新密码
+	PasswordFile     string        `mapstructure:"password_file"`
+	PasswordProvider string        `mapstructure:"password_provider"`
+	PasswordRefresh  time.Duration `mapstructure:"password_refresh"`
+	DB               int
+	// 最大连接数, 默认 10 * cpu 核数
+	PoolSize     int `mapstructure:"pool_size"`
+	MinIdleConns int `mapstructure:"min_idle_conns"`
+	// 连接最长存活时间, 默认不限制
+	MaxConnAge time.Duration `mapstructure:"max_conn_age"`
+	// 连接池已满时的等待时间, 默认 read_timeout + 1s
+	PoolTimeout time.Duration `mapstructure:"pool_timeout"`
+	// 空闲连接关闭时间, 默认 5m
+	IdleTimeout        time.Duration `mapstructure:"idle_timeout"`
+	IdleCheckFrequency time.Duration `mapstructure:"idle_check_frequency"`
+	// 默认 5s
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// 默认 3s
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+	// 默认与 read_timeout 相同
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// 命令失败时的重试次数, 默认 3
+	MaxRetries      int           `mapstructure:"max_retries"`
+	MinRetryBackoff time.Duration `mapstructure:"min_retry_backoff"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+	// false|true|skip-verify, 配置证书时自动启用
+	TLS           string
+	TLSCA         string `mapstructure:"tls_ca"`
+	TLSCert       string `mapstructure:"tls_cert"`
+	TLSKey        string `mapstructure:"tls_key"`
+	TLSServerName string `mapstructure:"tls_server_name"`
+	// strict|lazy, strict 初始化时 ping 失败则初始化失败, 默认 lazy
+	InitMode string `mapstructure:"init_mode"`
+	// 后台 ping 的间隔, 连接断开及恢复时输出日志, 默认 10s, -1 关闭
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	// 配置变更后等待旧客户端命令结束的最长时间, 之后关闭旧客户端, 默认 30s
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
 }
 
+func (c *Config) options() (*redis.UniversalOptions, error) {
+	opt := &redis.UniversalOptions{
+		Addrs:              c.addrs(),
+		MasterName:         c.MasterName,
+		SentinelPassword:   c.SentinelPassword,
+		MaxRedirects:       c.MaxRedirects,
+		ReadOnly:           c.ReadOnly,
+		RouteByLatency:     c.RouteByLatency,
+		RouteRandomly:      c.RouteRandomly,
+		Username:           c.Username,
+		Password:           c.Password,
+		DB:                 c.DB,
+		MaxRetries:         c.MaxRetries,
+		MinRetryBackoff:    c.MinRetryBackoff,
+		MaxRetryBackoff:    c.MaxRetryBackoff,
+		DialTimeout:        c.DialTimeout,
+		ReadTimeout:        c.ReadTimeout,
+		WriteTimeout:       c.WriteTimeout,
+		PoolSize:           c.PoolSize,
+		MinIdleConns:       c.MinIdleConns,
+		MaxConnAge:         c.MaxConnAge,
+		PoolTimeout:        c.PoolTimeout,
+		IdleTimeout:        c.IdleTimeout,
+		IdleCheckFrequency: c.IdleCheckFrequency,
+	}
+	if opt.DialTimeout == 0 {
+		opt.DialTimeout = defaultDialTimeout
+	}
+	if opt.ReadTimeout == 0 {
+		opt.ReadTimeout = defaultReadTimeout
+	}
+	if opt.MaxRetries == 0 {
+		opt.MaxRetries = defaultMaxRetries
+	}
+	var err error
+	opt.TLSConfig, err = c.tlsConfig()
+	return opt, err
+}
+
+// 按 mode 创建客户端, 配置错误时返回的客户端所有命令均返回该错误, 可先通过 Configs.Validate 校验
+func (c *Config) NewUniversalClient() redis.UniversalClient {
+	opt, err := c.options()
+	if err != nil {
+		opt.Dialer = failingDialer(err)
+	}
+	return c.build(opt)
+}
+
+// 兼容 standalone 及 sentinel 模式的 *redis.Client, cluster 模式的客户端所有命令返回错误
 func (c *Config) NewClient() *redis.Client {
-	if c.Addr == "" {
-		c.Addr = "localhost:6379"
+	opt, err := c.options()
+	if err == nil && c.mode() == ModeCluster {
+		err = errClusterClient
+	}
+	if err != nil {
+		opt.Dialer = failingDialer(err)
+	}
+	if c.mode() == ModeSentinel {
+		return redis.NewFailoverClient(opt.Failover())
+	}
+	simple := opt.Simple()
+	simple.Network = c.Network
+	return redis.NewClient(simple)
+}
+
+func (c *Config) validate(name string) error {
+	if err := c.validateMode(); err != nil {
+		return err
+	}
+	switch c.Network {
+	case "", "tcp", "unix":
+	default:
+		return fmt.Errorf("unknown network %q", c.Network)
+	}
+	if c.DB < 0 {
+		return fmt.Errorf("invalid db %d", c.DB)
+	}
+	if c.PoolSize < 0 || c.MinIdleConns < 0 {
+		return fmt.Errorf("pool_size and min_idle_conns must not be negative")
 	}
-	opt := &redis.Options{
-		Addr:     c.Addr,
+	if c.PoolSize > 0 && c.MinIdleConns > c.PoolSize {
+		return fmt.Errorf("min_idle_conns %d exceeds pool_size %d", c.MinIdleConns, c.PoolSize)
+	}
+	if c.DialTimeout < 0 || c.PoolTimeout < 0 || c.MaxConnAge < 0 {
+		return fmt.Errorf("dial_timeout, pool_timeout and max_conn_age must not be negative")
+	}
+	for _, d := range []time.Duration{c.ReadTimeout, c.WriteTimeout, c.IdleTimeout, c.IdleCheckFrequency, c.MinRetryBackoff, c.MaxRetryBackoff} {
+		if d < -1 {
+			return fmt.Errorf("timeouts must not be negative except -1")
+		}
+	}
+	if c.MaxRetries < -1 {
+		return fmt.Errorf("invalid max_retries %d", c.MaxRetries)
+	}
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+	if err := c.validateHealth(); err != nil {
+		return err
+	}
+	return c.passwordSource(name).Validate()
+}
+
+func (c *Config) passwordSource(name string) credential.Source {
+	return credential.Source{
+		Key:      "redis." + name,
 		Password: c.Password,
-		DB:       c.DB,
+		File:     c.PasswordFile,
+		Provider: c.PasswordProvider,
+		Refresh:  c.PasswordRefresh,
 	}
-	return redis.NewClient(opt)
+}
+
+// 密码可轮换时每个新建的连接使用当前密码认证, 已建立的连接不受影响
+func (c *Config) newClient(name string) (redis.UniversalClient, *credential.Credential, error) {
+	opt, err := c.options()
+	if err != nil {
+		return nil, nil, err
+	}
+	src := c.passwordSource(name)
+	if !src.Dynamic() {
+		return c.build(opt), nil, nil
+	}
+	if c.mode() == ModeSentinel {
+		return nil, nil, fmt.Errorf("password_file and password_provider are not supported in sentinel mode")
+	}
+	creds, err := credential.Watch(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := opt.DB
+	opt.Password, opt.DB = "", 0
+	opt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		_, err := cn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			if password := creds.Password(); password != "" && opt.Username != "" {
+				pipe.AuthACL(ctx, opt.Username, password)
+			} else if password != "" {
+				pipe.Auth(ctx, password)
+			}
+			if db > 0 {
+				pipe.Select(ctx, db)
+			}
+			return nil
+		})
+		return err
+	}
+	return c.build(opt), creds, nil
 }
 
 // on server starting
@@ -36,24 +235,147 @@ func (c *Configs) Init() (err error) {
 		return nil
 	}
 	for name, config := range *c {
-		instance[name] = config.NewClient()
+		if config == nil {
+			continue
+		}
+		h, err := openHandle(name, *config)
+		if err != nil {
+			return err
+		}
+		if old := instances.swap(name, h); old != nil {
+			old.close()
+		}
+	}
+	return nil
+}
+
+// on config change, 变更的配置段创建新客户端并替换, 旧客户端等待命令结束后关闭
+// 新客户端创建失败时保留旧客户端, 新增的配置段创建客户端, 删除的配置段关闭客户端
+func (c *Configs) Change() error {
+	if c == nil {
+		return nil
+	}
+	for name, config := range *c {
+		if config == nil {
+			continue
+		}
+		old, ok := instances.get(name)
+		if ok && reflect.DeepEqual(old.config, *config) {
+			continue
+		}
+		h, err := openHandle(name, *config)
+		if err != nil {
+			log.Logger.Errorf("%s", err.Error())
+			log.Logger.Errorf("redis [%s] reload failed, keep the old client", name)
+			continue
+		}
+		if old = instances.swap(name, h); old != nil {
+			instances.retire(old)
+		}
+		log.Logger.Infof("redis [%s] reload success", name)
+	}
+	for _, name := range instances.names() {
+		if config, ok := (*c)[name]; ok && config != nil {
+			continue
+		}
+		if old := instances.remove(name); old != nil {
+			instances.retire(old)
+		}
+		log.Logger.Infof("redis [%s] removed", name)
+	}
+	return nil
+}
+
+// config check
+func (c *Configs) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for name, config := range *c {
+		if config == nil {
+			continue
+		}
+		if err := config.validate(name); err != nil {
+			return fmt.Errorf("redis [%s] %s", name, err.Error())
+		}
 	}
 	return nil
 }
 
-// on server closing
-func (c *Configs) Close() {
-	for name, client := range instance {
-		if err := client.Close(); err != nil {
-			log.Logger.Errorf("redis [%s] close err:%s", name, err.Error())
+// config check, ping with a temporary client
+func (c *Configs) Probe(ctx context.Context) []config.ProbeResult {
+	if c == nil {
+		return nil
+	}
+	results := make([]config.ProbeResult, 0, len(*c))
+	for name, conf := range *c {
+		if conf == nil {
+			continue
+		}
+		start := time.Now()
+		opt, err := conf.options()
+		var password string
+		if err == nil {
+			password, err = conf.passwordSource(name).Read(ctx)
 		}
+		if err == nil {
+			opt.Password = password
+			client := conf.build(opt)
+			err = client.Ping(ctx).Err()
+			client.Close()
+		}
+		results = append(results, config.ProbeResult{Name: name, Err: err, Cost: time.Since(start)})
 	}
+	return results
 }
 
-// global api
-func Get(name string) (*redis.Client, error) {
-	if client, ok := instance[name]; ok {
-		return client, nil
+// on server closing, 关闭所有客户端(包括等待关闭的旧客户端), 返回第一个错误
+func (c *Configs) Close() (err error) {
+	handles, draining := instances.reset()
+	for _, h := range draining {
+		h.close()
+	}
+	names := make([]string, 0, len(handles))
+	for name := range handles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if e := handles[name].close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// global api, 按配置的 mode 返回 *redis.Client 或 *redis.ClusterClient
+func Get(name string) (redis.UniversalClient, error) {
+	if h, ok := instances.get(name); ok {
+		return h.client, nil
 	}
 	return nil, fmt.Errorf("%s redis not found", name)
 }
+
+// 兼容旧版本的 *redis.Client, cluster 模式返回错误
+func GetClient(name string) (*redis.Client, error) {
+	client, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := client.(*redis.Client)
+	if !ok {
+		return nil, fmt.Errorf("redis [%s] %s", name, errClusterClient.Error())
+	}
+	return c, nil
+}
+
+// pool stats of all clients
+func PoolStats() map[string]*redis.PoolStats {
+	stats := make(map[string]*redis.PoolStats)
+	for _, name := range instances.names() {
+		if h, ok := instances.get(name); ok {
+			stats[name] = h.client.PoolStats()
+		}
+	}
+	return stats
+}
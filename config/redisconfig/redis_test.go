@@ -0,0 +1,105 @@
+package redisconfig
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_options(t *testing.T) {
+	c := &Config{PoolSize: 50, ReadTimeout: -1, Username: "app", MaxRetries: -1}
+	opt, err := c.options()
+	if err != nil {
+		t.Fatalf("options() error = %v", err)
+	}
+	if opt.Addrs[0] != defaultAddr || opt.DialTimeout != defaultDialTimeout || opt.Username != "app" || opt.PoolSize != 50 {
+		t.Errorf("options() = %+v", opt)
+	}
+	// -1 交由 go-redis 关闭超时及重试
+	if opt.ReadTimeout != -1 || opt.MaxRetries != -1 || opt.TLSConfig != nil {
+		t.Errorf("options() = %+v", opt)
+	}
+
+	opt, _ = (&Config{Addr: "cache.internal:6380", TLS: "true", TLSServerName: "cache"}).options()
+	if opt.ReadTimeout != defaultReadTimeout || opt.MaxRetries != defaultMaxRetries {
+		t.Errorf("options() defaults = %+v", opt)
+	}
+	if opt.TLSConfig == nil || opt.TLSConfig.ServerName != "cache" {
+		t.Errorf("options() tls = %+v", opt.TLSConfig)
+	}
+	client := (&Config{}).NewClient()
+	defer client.Close()
+	if got := client.Options().PoolSize; got != 10*runtime.NumCPU() {
+		t.Errorf("PoolSize = %d, want %d", got, 10*runtime.NumCPU())
+	}
+}
+
+func TestConfigs_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"ok", Config{Addr: "127.0.0.1:6379", PoolSize: 10, MinIdleConns: 2, ReadTimeout: -1, WriteTimeout: time.Second}, ""},
+		{"unix", Config{Network: "unix", Addr: "/tmp/redis.sock"}, ""},
+		{"addr", Config{Addr: "127.0.0.1"}, "invalid addr"},
+		{"network", Config{Network: "udp"}, "unknown network"},
+		{"min idle", Config{PoolSize: 2, MinIdleConns: 3}, "exceeds pool_size"},
+		{"timeout", Config{DialTimeout: -time.Second}, "must not be negative"},
+		{"read timeout", Config{ReadTimeout: -time.Second}, "except -1"},
+		{"retries", Config{MaxRetries: -2}, "max_retries"},
+		{"tls mode", Config{TLS: "preferred"}, "unknown tls mode"},
+		{"tls key", Config{TLSCert: "cert.pem"}, "set together"},
+		{"tls ca", Config{TLSCA: "/nonexistent/ca.pem"}, "no such file"},
+		{"sentinel", Config{Mode: "sentinel", MasterName: "mymaster", Addrs: []string{"10.0.0.1:26379", "10.0.0.2:26379"}}, ""},
+		{"sentinel master", Config{Mode: "sentinel", Addrs: []string{"10.0.0.1:26379"}}, "master_name"},
+		{"sentinel password file", Config{Mode: "sentinel", MasterName: "mymaster", PasswordFile: "/run/secrets/redis"}, "not supported"},
+		{"cluster", Config{Mode: "Cluster", Addrs: []string{"10.0.0.1:7000", "10.0.0.2:7000"}, ReadOnly: true}, ""},
+		{"cluster db", Config{Mode: "cluster", DB: 1}, "db must be 0"},
+		{"cluster addrs", Config{Mode: "cluster", Addrs: []string{"10.0.0.1"}}, "invalid addr"},
+		{"standalone addrs", Config{Addrs: []string{"10.0.0.1:6379"}}, "requires sentinel or cluster"},
+		{"mode", Config{Mode: "proxy"}, "unknown mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config
+			err := (&Configs{"cache": &c}).Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGet_Mode(t *testing.T) {
+	configs := Configs{
+		"standalone": &Config{Addr: "127.0.0.1:6379"},
+		"sentinel":   &Config{Mode: ModeSentinel, MasterName: "mymaster", Addrs: []string{"127.0.0.1:26379"}},
+		"cluster":    &Config{Mode: ModeCluster, Addrs: []string{"127.0.0.1:7000"}},
+	}
+	if err := configs.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer configs.Close()
+
+	for name, want := range map[string]string{"standalone": "*redis.Client", "sentinel": "*redis.Client", "cluster": "*redis.ClusterClient"} {
+		client, err := Get(name)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", name, err)
+		}
+		if got := fmt.Sprintf("%T", client); got != want {
+			t.Errorf("Get(%s) = %s, want %s", name, got, want)
+		}
+	}
+	if _, err := GetClient("sentinel"); err != nil {
+		t.Errorf("GetClient(sentinel) error = %v", err)
+	}
+	if _, err := GetClient("cluster"); err == nil {
+		t.Error("GetClient(cluster) returned no error")
+	}
+}
@@ -0,0 +1,181 @@
+package redisconfig
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/zhouchang2017/toolkit/config/credential"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	// 替换客户端后, 给已取得旧客户端的调用方留出发起命令的时间
+	drainGrace = time.Second
+)
+
+var (
+	instances = &registry{handles: map[string]*handle{}, draining: map[*handle]struct{}{}}
+)
+
+// 一个配置段对应的客户端
+type handle struct {
+	name    string
+	config  Config
+	client  redis.UniversalClient
+	creds   *credential.Credential
+	monitor *monitor
+	once    sync.Once
+	closed  chan struct{}
+	err     error
+}
+
+// 创建客户端, strict 模式 ping 失败时关闭客户端并返回错误
+func openHandle(name string, c Config) (*handle, error) {
+	client, creds, err := c.newClient(name)
+	if err != nil {
+		return nil, fmt.Errorf("redis [%s] init err:%s", name, err.Error())
+	}
+	h := &handle{
+		name:    name,
+		config:  c,
+		client:  client,
+		creds:   creds,
+		monitor: newMonitor(name, client, c.healthCheckInterval()),
+		closed:  make(chan struct{}),
+	}
+	strict := c.initMode() == InitStrict
+	if strict {
+		if err := h.monitor.check(); err != nil {
+			h.close()
+			return nil, fmt.Errorf("redis [%s] ping err:%s", name, err.Error())
+		}
+	}
+	h.monitor.start(!strict)
+	return h, nil
+}
+
+func (h *handle) close() error {
+	h.once.Do(func() {
+		h.monitor.close()
+		if err := h.client.Close(); err != nil {
+			log.Logger.Errorf("redis [%s] close err:%s", h.name, err.Error())
+			h.err = fmt.Errorf("redis [%s] close err:%w", h.name, err)
+		}
+		if h.creds != nil {
+			h.creds.Close()
+		}
+		close(h.closed)
+	})
+	return h.err
+}
+
+// 正在使用的连接数
+func (h *handle) inUse() int {
+	stats := h.client.PoolStats()
+	return int(stats.TotalConns) - int(stats.IdleConns)
+}
+
+// 等待 d, 期间已关闭时返回 false
+func (h *handle) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-h.closed:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// 等待正在执行的命令结束后关闭, 超时强制关闭
+func (h *handle) drain() {
+	timeout := h.config.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if !h.wait(drainGrace) {
+		return
+	}
+	for h.inUse() > 0 && time.Now().Before(deadline) {
+		if !h.wait(100 * time.Millisecond) {
+			return
+		}
+	}
+	if n := h.inUse(); n > 0 {
+		log.Logger.Warnf("redis [%s] drain timeout, %d connections still in use", h.name, n)
+	}
+	h.close()
+}
+
+type registry struct {
+	mu      sync.RWMutex
+	handles map[string]*handle
+	// 替换或删除后等待关闭的客户端
+	draining map[*handle]struct{}
+}
+
+func (r *registry) get(name string) (*handle, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handles[name]
+	return h, ok
+}
+
+// 替换客户端, 返回旧的客户端
+func (r *registry) swap(name string, h *handle) *handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.handles[name]
+	r.handles[name] = h
+	return old
+}
+
+func (r *registry) remove(name string) *handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.handles[name]
+	delete(r.handles, name)
+	return h
+}
+
+func (r *registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handles))
+	for name := range r.handles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 在后台等待旧客户端的命令结束后关闭
+func (r *registry) retire(h *handle) {
+	r.mu.Lock()
+	r.draining[h] = struct{}{}
+	r.mu.Unlock()
+	go func() {
+		h.drain()
+		r.mu.Lock()
+		delete(r.draining, h)
+		r.mu.Unlock()
+	}()
+}
+
+// 移除全部客户端, 返回使用中及等待关闭的客户端
+func (r *registry) reset() (map[string]*handle, []*handle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handles := r.handles
+	r.handles = map[string]*handle{}
+	draining := make([]*handle, 0, len(r.draining))
+	for h := range r.draining {
+		draining = append(draining, h)
+	}
+	return handles, draining
+}
@@ -0,0 +1,94 @@
+package redisconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestConfigs_Change(t *testing.T) {
+	a, b := miniredis.RunT(t), miniredis.RunT(t)
+
+	conf := func(addr string) *Config {
+		return &Config{Addr: addr, MaxRetries: -1, HealthCheckInterval: -1, DrainTimeout: time.Second}
+	}
+	c := Configs{"cache": conf(a.Addr()), "session": conf(a.Addr())}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+	old, _ := instances.get("cache")
+	kept, _ := instances.get("session")
+
+	changed := Configs{
+		"cache":   conf(b.Addr()),
+		"session": conf(a.Addr()),
+		"queue":   conf(b.Addr()),
+	}
+	if err := changed.Change(); err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	defer changed.Close()
+	h, _ := instances.get("cache")
+	if h == old {
+		t.Fatal("changed section should swap its client")
+	}
+	if h.config.Addr != b.Addr() {
+		t.Errorf("client addr = %s, want %s", h.config.Addr, b.Addr())
+	}
+	if h, _ := instances.get("session"); h != kept {
+		t.Error("unchanged section should keep its client")
+	}
+	for _, name := range []string{"cache", "queue"} {
+		client, err := Get(name)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", name, err)
+		}
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			t.Errorf("Get(%s).Ping() error = %v", name, err)
+		}
+	}
+	// 旧客户端在等待期内仍可使用
+	if err := old.client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("old client Ping() error = %v", err)
+	}
+
+	removed := Configs{"cache": conf(b.Addr())}
+	if err := removed.Change(); err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	defer removed.Close()
+	for _, name := range []string{"session", "queue"} {
+		if _, err := Get(name); err == nil {
+			t.Errorf("Get(%s) error = nil after removed", name)
+		}
+	}
+
+	time.Sleep(drainGrace + 200*time.Millisecond)
+	if err := old.client.Ping(context.Background()).Err(); err == nil {
+		t.Error("old client should be closed after drain")
+	}
+}
+
+func TestConfigs_ChangeKeepOnFailure(t *testing.T) {
+	r := miniredis.RunT(t)
+
+	c := Configs{"cache": &Config{Addr: r.Addr(), HealthCheckInterval: -1}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+	old, _ := instances.get("cache")
+
+	// 无法连接的地址, strict 模式 ping 失败
+	broken := Configs{"cache": &Config{Addr: "127.0.0.1:1", InitMode: InitStrict, DialTimeout: 100 * time.Millisecond, MaxRetries: -1}}
+	if err := broken.Change(); err != nil {
+		t.Fatalf("Change() error = %v", err)
+	}
+	defer broken.Close()
+	if h, _ := instances.get("cache"); h != old {
+		t.Error("failed reload should keep the old client")
+	}
+}
@@ -0,0 +1,59 @@
+package redisconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var tlsModes = map[string]bool{
+	"":            true,
+	"false":       true,
+	"true":        true,
+	"skip-verify": true,
+}
+
+func (c *Config) validateTLS() error {
+	if !tlsModes[strings.ToLower(c.TLS)] {
+		return fmt.Errorf("unknown tls mode %q", c.TLS)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	_, err := c.tlsConfig()
+	return err
+}
+
+// tls 配置, 未启用时返回 nil, 配置证书时自动启用, 未配置 server name 时按连接的节点地址校验
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	mode := strings.ToLower(c.TLS)
+	custom := c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != ""
+	if mode == "false" || (mode == "" && !custom) {
+		return nil, nil
+	}
+	conf := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: mode == "skip-verify",
+	}
+	if c.TLSCA != "" {
+		pem, err := ioutil.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.TLSCA)
+		}
+		conf.RootCAs = pool
+	}
+	if c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/didi/gendry/scanner"
+	"github.com/go-redis/redis/v8"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const defaultCacheTTL = 5 * time.Minute
+
+// 缓存值前缀, 区分记录及未找到
+const (
+	cacheFound   = '1'
+	cacheMissing = '0'
+)
+
+// 缓存记录的编解码
+type CacheCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// encoding/json 编解码, 默认
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// FindByKey 的读穿透缓存, Insert、UpdateByKey、DeleteByKey 及事务版本在执行后删除缓存, 事务提交后再次删除
+// Update、Delete 等按条件修改的方法不删除缓存, 需调用 InvalidateCache
+type CacheOption struct {
+	// redisconfig 配置段名称
+	Handle string
+	// key 前缀, 默认 表名:
+	Prefix string
+	// 默认 5m
+	TTL time.Duration
+	// 未找到记录的缓存时间, 为 0 时不缓存
+	NegativeTTL time.Duration
+	// 默认 JSONCodec
+	Codec CacheCodec
+}
+
+type daoCache struct {
+	handle      string
+	prefix      string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	codec       CacheCodec
+	flight      *flightGroup
+}
+
+func newDaoCache(tableName string, opt *CacheOption) (*daoCache, error) {
+	if opt.Handle == "" {
+		return nil, errors.New("cache handle is required")
+	}
+	if opt.TTL < 0 || opt.NegativeTTL < 0 {
+		return nil, errors.New("cache ttl must not be negative")
+	}
+	c := &daoCache{
+		handle:      opt.Handle,
+		prefix:      opt.Prefix,
+		ttl:         opt.TTL,
+		negativeTTL: opt.NegativeTTL,
+		codec:       opt.Codec,
+		flight:      &flightGroup{calls: map[string]*flightCall{}},
+	}
+	if c.prefix == "" {
+		c.prefix = tableName + ":"
+	}
+	if c.ttl == 0 {
+		c.ttl = defaultCacheTTL
+	}
+	if c.codec == nil {
+		c.codec = JSONCodec{}
+	}
+	return c, nil
+}
+
+func (c *daoCache) key(key interface{}) string {
+	return c.prefix + fmt.Sprint(key)
+}
+
+func (c *daoCache) decode(data []byte, record interface{}) error {
+	if len(data) == 0 {
+		return errors.New("empty cache value")
+	}
+	switch data[0] {
+	case cacheMissing:
+		return scanner.ErrEmptyResult
+	case cacheFound:
+		return c.codec.Unmarshal(data[1:], record)
+	}
+	return fmt.Errorf("unknown cache value %q", data[0])
+}
+
+// 读取缓存, 未命中时同一 key 只有一个调用方执行 load 并写入缓存, 其他调用方共享结果
+// redis 不可用或缓存值无法解码时直接执行 load
+func (c *daoCache) get(ctx context.Context, key interface{}, record interface{}, load func() error) error {
+	k := c.key(key)
+	client, err := redisconfig.Get(c.handle)
+	if err != nil {
+		log.Logger.Warnf("cache [%s] %s", c.handle, err.Error())
+		return load()
+	}
+	data, err := client.Get(ctx, k).Bytes()
+	if err == nil {
+		if err = c.decode(data, record); err == nil || errors.Is(err, scanner.ErrEmptyResult) {
+			return err
+		}
+		log.Logger.Warnf("cache [%s] decode %s err:%s", c.handle, k, err.Error())
+	} else if err != redis.Nil {
+		log.Logger.Warnf("cache [%s] get %s err:%s", c.handle, k, err.Error())
+	}
+
+	data, leader, err := c.flight.do(k, func() ([]byte, error) {
+		err := load()
+		var value []byte
+		ttl := c.ttl
+		switch {
+		case err == nil:
+			encoded, e := c.codec.Marshal(record)
+			if e != nil {
+				log.Logger.Warnf("cache [%s] encode %s err:%s", c.handle, k, e.Error())
+				return nil, nil
+			}
+			value = append([]byte{cacheFound}, encoded...)
+		case errors.Is(err, scanner.ErrEmptyResult) && c.negativeTTL > 0:
+			value, ttl = []byte{cacheMissing}, c.negativeTTL
+		default:
+			return nil, err
+		}
+		if e := client.Set(ctx, k, value, ttl).Err(); e != nil {
+			log.Logger.Warnf("cache [%s] set %s err:%s", c.handle, k, e.Error())
+		}
+		return value, err
+	})
+	if leader || err != nil {
+		return err
+	}
+	if data == nil {
+		// 编码失败, 自行查询
+		return load()
+	}
+	return c.decode(data, record)
+}
+
+// 删除缓存, 失败时记录日志
+func (c *daoCache) invalidate(ctx context.Context, keys ...interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	client, err := redisconfig.Get(c.handle)
+	if err != nil {
+		log.Logger.Errorf("cache [%s] invalidate err:%s", c.handle, err.Error())
+		return err
+	}
+	ks := make([]string, len(keys))
+	for i, key := range keys {
+		ks[i] = c.key(key)
+	}
+	if err = client.Del(ctx, ks...).Err(); err != nil {
+		log.Logger.Errorf("cache [%s] invalidate %v err:%s", c.handle, ks, err.Error())
+	}
+	return err
+}
+
+// 写操作后删除缓存, 事务中立即删除, 由 mysqlconfig.BeginTx 开启的事务在提交后再次删除
+func (s SQLDao) invalidate(ctx context.Context, tx *sql.Tx, key interface{}) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.invalidate(ctx, key)
+	if tx != nil {
+		mysqlconfig.AfterCommit(tx, func() {
+			s.cache.invalidate(context.Background(), key)
+		})
+	}
+}
+
+// 新增记录后删除可能缓存的未找到, 数据中没有主键时使用自增 id
+func (s SQLDao) invalidateInsert(ctx context.Context, tx *sql.Tx, data map[string]interface{}, id int64) {
+	if s.cache == nil {
+		return
+	}
+	key, ok := data[s.pk]
+	if !ok {
+		if id <= 0 {
+			return
+		}
+		key = id
+	}
+	s.invalidate(ctx, tx, key)
+}
+
+// 删除指定主键的缓存, 用于按条件修改记录后, 未配置缓存时直接返回
+func (s SQLDao) InvalidateCache(ctx context.Context, keys ...interface{}) error {
+	if s.cache == nil {
+		return nil
+	}
+	return s.cache.invalidate(ctx, keys...)
+}
+
+// 合并同一 key 的并发调用
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+// 执行 fn, 同一 key 正在执行时等待并返回其结果, leader 表示由当前调用方执行
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) (data []byte, leader bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.data, false, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.data, call.err = fn()
+	return call.data, true, call.err
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/didi/gendry/scanner"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+)
+
+type cachedUser struct {
+	ID   int64
+	Name string
+}
+
+func TestDaoCache_get(t *testing.T) {
+	fake := miniredis.RunT(t)
+	c := redisconfig.Configs{"cache": &redisconfig.Config{Addr: fake.Addr(), MaxRetries: -1, HealthCheckInterval: -1}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+
+	dao := NewSQLDao("users", "db", "id", &SQLDaoOption{Cache: &CacheOption{Handle: "cache", NegativeTTL: time.Minute}})
+	ctx := context.Background()
+	var loads int32
+	load := func(record *cachedUser, found bool) func() error {
+		return func() error {
+			atomic.AddInt32(&loads, 1)
+			if !found {
+				return scanner.ErrEmptyResult
+			}
+			*record = cachedUser{ID: 1, Name: "tom"}
+			return nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		var u cachedUser
+		if err := dao.cache.get(ctx, 1, &u, load(&u, true)); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+		if u.Name != "tom" {
+			t.Errorf("get() = %+v, want tom", u)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+	if !fake.Exists("users:1") {
+		t.Error("record should be cached under users:1")
+	}
+
+	// 未找到的记录缓存为负条目
+	for i := 0; i < 2; i++ {
+		var u cachedUser
+		if err := dao.cache.get(ctx, 2, &u, load(&u, false)); !errors.Is(err, scanner.ErrEmptyResult) {
+			t.Fatalf("get() error = %v, want ErrEmptyResult", err)
+		}
+	}
+	if loads != 2 {
+		t.Errorf("loads = %d, want 2", loads)
+	}
+
+	if err := dao.InvalidateCache(ctx, 1, 2); err != nil {
+		t.Fatalf("InvalidateCache() error = %v", err)
+	}
+	if fake.Exists("users:1") {
+		t.Error("users:1 should be invalidated")
+	}
+	dao.invalidate(ctx, nil, 3)
+}
+
+func TestDaoCache_singleflight(t *testing.T) {
+	fake := miniredis.RunT(t)
+	c := redisconfig.Configs{"cache": &redisconfig.Config{Addr: fake.Addr(), MaxRetries: -1, HealthCheckInterval: -1}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+
+	dao := NewSQLDao("users", "db", "id", &SQLDaoOption{Cache: &CacheOption{Handle: "cache"}})
+	var loads int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u cachedUser
+			err := dao.cache.get(context.Background(), 7, &u, func() error {
+				atomic.AddInt32(&loads, 1)
+				<-release
+				u = cachedUser{ID: 7, Name: "jerry"}
+				return nil
+			})
+			if err == nil && u.Name != "jerry" {
+				err = fmt.Errorf("get() = %+v, want jerry", u)
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+}
+
+func TestDaoCache_redisDown(t *testing.T) {
+	dao := NewSQLDao("users", "db", "id", &SQLDaoOption{Cache: &CacheOption{Handle: "missing"}})
+	var u cachedUser
+	err := dao.cache.get(context.Background(), 1, &u, func() error {
+		u = cachedUser{ID: 1}
+		return nil
+	})
+	if err != nil || u.ID != 1 {
+		t.Errorf("get() = %+v, %v, want fall back to load", u, err)
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// sql 方言, gendry 按 mysql 语法生成语句, 执行前按方言转换
+type dialect struct {
+	name string
+	// 标识符引号
+	quote byte
+	// 使用 $1, $2 占位符
+	numbered bool
+	// 使用 LIMIT ? OFFSET ? 分页
+	limitOffset bool
+	// 通过 RETURNING 获取自增主键
+	returning bool
+}
+
+var dialects = map[string]*dialect{
+	mysqlconfig.DialectMySQL:    {name: mysqlconfig.DialectMySQL, quote: '`'},
+	mysqlconfig.DialectSQLite:   {name: mysqlconfig.DialectSQLite, quote: '"', limitOffset: true},
+	mysqlconfig.DialectPostgres: {name: mysqlconfig.DialectPostgres, quote: '"', numbered: true, limitOffset: true, returning: true},
+}
+
+func getDialect(name string) *dialect {
+	if d, ok := dialects[name]; ok {
+		return d
+	}
+	return dialects[mysqlconfig.DialectMySQL]
+}
+
+// 引用标识符, 支持 db.table 形式
+func (d *dialect) Quote(ident string) string {
+	q := string(d.quote)
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		parts[i] = q + strings.Replace(part, q, q+q, -1) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+// 将 mysql 风格的语句转换为当前方言
+func (d *dialect) rebind(query string, args []interface{}) (string, []interface{}) {
+	if d.name == mysqlconfig.DialectMySQL {
+		return query, args
+	}
+
+	// gendry 将分页参数追加在参数末尾
+	if d.limitOffset && len(args) >= 2 {
+		if i := strings.LastIndex(query, " LIMIT ?,?"); i >= 0 {
+			query = query[:i] + " LIMIT ? OFFSET ?" + query[i+len(" LIMIT ?,?"):]
+			n := len(args)
+			args = append(args[:n-2:n-2], args[n-1], args[n-2])
+		}
+	}
+
+	var buf strings.Builder
+	buf.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			buf.WriteByte(ch)
+		case inString:
+			buf.WriteByte(ch)
+		case ch == '`':
+			buf.WriteByte(d.quote)
+		case ch == '?' && d.numbered:
+			n++
+			buf.WriteByte('$')
+			buf.WriteString(strconv.Itoa(n))
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String(), args
+}
+
+// 当前连接的 sql 方言
+func (s SQLDao) dialect() *dialect {
+	return getDialect(mysqlconfig.Dialect(s.handleName))
+}
+
+// 按当前连接的方言引用标识符
+func (s SQLDao) Quote(ident string) string {
+	return s.dialect().Quote(ident)
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/didi/gendry/builder"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+func TestDialect_rebind(t *testing.T) {
+	where := map[string]interface{}{"name": "a", "`order` >": 1, "_limit": []uint{20, 10}}
+	cond, vals, err := builder.BuildSelect("users", where, []string{"*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dialect string
+		want    string
+		vals    []interface{}
+	}{
+		{mysqlconfig.DialectMySQL, "SELECT * FROM users WHERE (name=? AND `order`>?) LIMIT ?,?", []interface{}{"a", 1, 20, 10}},
+		{mysqlconfig.DialectSQLite, `SELECT * FROM users WHERE (name=? AND "order">?) LIMIT ? OFFSET ?`, []interface{}{"a", 1, 10, 20}},
+		{mysqlconfig.DialectPostgres, `SELECT * FROM users WHERE (name=$1 AND "order">$2) LIMIT $3 OFFSET $4`, []interface{}{"a", 1, 10, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			got, gotVals := getDialect(tt.dialect).rebind(cond, vals)
+			if got != tt.want {
+				t.Errorf("rebind() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotVals, tt.vals) {
+				t.Errorf("rebind() vals = %v, want %v", gotVals, tt.vals)
+			}
+		})
+	}
+}
+
+func TestDialect_Quote(t *testing.T) {
+	if got := getDialect(mysqlconfig.DialectPostgres).Quote(`public.user"s`); got != `"public"."user""s"` {
+		t.Errorf("Quote() = %v", got)
+	}
+	if got := getDialect("unknown").Quote("db.users"); got != "`db`.`users`" {
+		t.Errorf("Quote() = %v", got)
+	}
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/schema"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+var ErrSchemaDrift = errors.New("record structs do not match table schema")
+
+// 结构体与表结构不一致项
+type Drift struct {
+	Handle string
+	Table  string
+	// 结构体字段, 主键不一致时为空
+	Field  string
+	Column string
+	Reason string
+}
+
+func (d Drift) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("[%s] %s: %s", d.Handle, d.Table, d.Reason)
+	}
+	return fmt.Sprintf("[%s] %s.%s (%s): %s", d.Handle, d.Table, d.Column, d.Field, d.Reason)
+}
+
+type registeredRecord struct {
+	dao *SQLDao
+	typ reflect.Type
+}
+
+var records = struct {
+	sync.Mutex
+	items []registeredRecord
+}{}
+
+// 注册 SQLDao 对应的记录结构体, 用于 CheckSchema 校验表结构
+func RegisterRecord(dao *SQLDao, record interface{}) {
+	typ := reflect.TypeOf(record)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("db: record of table [%s] must be a struct, got %s", dao.tableName, typ))
+	}
+	records.Lock()
+	defer records.Unlock()
+	for _, r := range records.items {
+		if r.typ == typ && r.dao.tableName == dao.tableName && r.dao.handleName == dao.handleName {
+			return
+		}
+	}
+	records.items = append(records.items, registeredRecord{dao: dao, typ: typ})
+}
+
+// 校验所有注册的结构体与表结构
+func CheckSchema(ctx context.Context) ([]Drift, error) {
+	records.Lock()
+	items := append([]registeredRecord(nil), records.items...)
+	records.Unlock()
+
+	drifts := make([]Drift, 0)
+	tables := map[string]*schema.Table{}
+	for _, r := range items {
+		daos, err := r.dao.tables(ctx)
+		if err != nil {
+			return drifts, err
+		}
+		for _, dao := range daos {
+			key := dao.handleName + "." + dao.tableName
+			t, ok := tables[key]
+			if !ok {
+				var err error
+				if t, err = schema.Describe(ctx, dao.handleName, dao.tableName); err != nil {
+					return drifts, err
+				}
+				tables[key] = t
+			}
+			drifts = append(drifts, compareSchema(dao, t, r.typ)...)
+		}
+	}
+	return drifts, nil
+}
+
+// 需要校验的表, 分片表逐个校验, 分区表校验各分片上已存在的分区(包括预先创建的分区)
+func (s SQLDao) tables(ctx context.Context) ([]*SQLDao, error) {
+	daos := make([]*SQLDao, 0)
+	for _, dao := range s.Shards() {
+		if dao.partition == nil {
+			daos = append(daos, dao)
+			continue
+		}
+		partitions, err := dao.existingPartitions(ctx, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range partitions {
+			daos = append(daos, &partitions[i])
+		}
+	}
+	return daos, nil
+}
+
+// 启动时校验表结构, 不一致项输出警告日志, 存在不一致时返回 ErrSchemaDrift
+func VerifySchema(ctx context.Context) error {
+	drifts, err := CheckSchema(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range drifts {
+		log.Logger.Warnf("schema drift %s", d)
+	}
+	if len(drifts) > 0 {
+		return fmt.Errorf("%w: %d mismatches", ErrSchemaDrift, len(drifts))
+	}
+	return nil
+}
+
+// 输出校验结果, 用于命令行
+func WriteSchemaReport(w io.Writer, drifts []Drift) {
+	for _, d := range drifts {
+		fmt.Fprintln(w, d)
+	}
+	if len(drifts) == 0 {
+		fmt.Fprintln(w, "schema ok")
+		return
+	}
+	fmt.Fprintf(w, "%d mismatches\n", len(drifts))
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+	nullTypes   = map[reflect.Type]string{
+		reflect.TypeOf(sql.NullBool{}):    "bool",
+		reflect.TypeOf(sql.NullInt32{}):   "int64",
+		reflect.TypeOf(sql.NullInt64{}):   "int64",
+		reflect.TypeOf(sql.NullFloat64{}): "float64",
+		reflect.TypeOf(sql.NullString{}):  "string",
+		reflect.TypeOf(sql.NullTime{}):    "time.Time",
+	}
+)
+
+func compareSchema(dao *SQLDao, t *schema.Table, typ reflect.Type) []Drift {
+	drifts := make([]Drift, 0)
+	add := func(field, column, reason string) {
+		drifts = append(drifts, Drift{Handle: dao.handleName, Table: dao.tableName, Field: field, Column: column, Reason: reason})
+	}
+
+	if pk := t.PrimaryKey(); dao.pk != "" && (len(pk) != 1 || pk[0] != dao.pk) {
+		add("", "", fmt.Sprintf("SQLDao pk %q, table primary key (%s)", dao.pk, strings.Join(pk, ", ")))
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, ok := f.Tag.Lookup("ddb")
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			tag = tag[:idx]
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := typ.Name() + "." + f.Name
+		column, ok := findColumn(t, tag)
+		if !ok {
+			add(name, tag, "column not found, field always zero")
+			continue
+		}
+		nullable, kind := fieldKind(f.Type)
+		if kind == "" {
+			// 自定义 sql.Scanner 不校验类型
+			continue
+		}
+		if !compatible(column, kind) {
+			add(name, tag, fmt.Sprintf("column type %s, field type %s", column.ColumnType, f.Type))
+		}
+		if column.Nullable && !nullable {
+			add(name, tag, fmt.Sprintf("column nullable, field type %s cannot hold NULL", f.Type))
+		}
+	}
+	return drifts
+}
+
+func findColumn(t *schema.Table, name string) (schema.Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return schema.Column{}, false
+}
+
+// 字段能否表示 NULL 及对应的类型分类, 自定义 sql.Scanner 分类为空
+func fieldKind(typ reflect.Type) (nullable bool, kind string) {
+	if typ.Kind() == reflect.Ptr {
+		nullable = true
+		typ = typ.Elem()
+	}
+	if k, ok := nullTypes[typ]; ok {
+		return true, k
+	}
+	switch {
+	case typ == timeType:
+		return nullable, "time.Time"
+	case typ == bytesType:
+		return true, "[]byte"
+	case reflect.PtrTo(typ).Implements(scannerType):
+		return true, ""
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return nullable, "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return nullable, "int64"
+	case reflect.Float32, reflect.Float64:
+		return nullable, "float64"
+	case reflect.String:
+		return nullable, "string"
+	}
+	return nullable, typ.String()
+}
+
+func columnKind(c schema.Column) string {
+	c.Nullable = false
+	switch t := c.GoType(); t {
+	case "uint64":
+		return "int64"
+	default:
+		return t
+	}
+}
+
+// 列类型能否扫描到字段类型
+func compatible(c schema.Column, field string) bool {
+	column := columnKind(c)
+	if column == field || field == "string" {
+		return true
+	}
+	switch column {
+	case "int64":
+		return field == "bool"
+	case "bool":
+		return field == "int64"
+	case "string":
+		// decimal 可扫描到浮点数
+		return field == "[]byte" || (field == "float64" && (c.DataType == "decimal" || c.DataType == "numeric"))
+	}
+	return false
+}
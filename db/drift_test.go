@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/schema"
+)
+
+type driftUser struct {
+	ID        uint64         `ddb:"id"`
+	Name      string         `ddb:"name"`
+	Email     string         `ddb:"email"`
+	Nickname  sql.NullString `ddb:"nickname"`
+	Age       int            `ddb:"age"`
+	Balance   float64        `ddb:"balance"`
+	Enabled   bool           `ddb:"enabled"`
+	Removed   string         `ddb:"removed"`
+	CreatedAt time.Time      `ddb:"created_at"`
+	UpdatedAt *time.Time     `ddb:"updated_at,omitempty"`
+	Ignored   string
+	internal  int `ddb:"internal"`
+}
+
+func TestCompareSchema(t *testing.T) {
+	table := &schema.Table{
+		Name: "users",
+		Columns: []schema.Column{
+			{Name: "id", DataType: "bigint", ColumnType: "bigint(20) unsigned", Primary: true},
+			{Name: "name", DataType: "varchar", ColumnType: "varchar(64)"},
+			{Name: "email", DataType: "varchar", ColumnType: "varchar(64)", Nullable: true},
+			{Name: "nickname", DataType: "varchar", ColumnType: "varchar(64)", Nullable: true},
+			{Name: "age", DataType: "varchar", ColumnType: "varchar(8)"},
+			{Name: "balance", DataType: "decimal", ColumnType: "decimal(10,2)"},
+			{Name: "enabled", DataType: "tinyint", ColumnType: "tinyint(1)"},
+			{Name: "created_at", DataType: "datetime", ColumnType: "datetime"},
+			{Name: "updated_at", DataType: "datetime", ColumnType: "datetime", Nullable: true},
+		},
+	}
+	dao := NewSQLDao("users", "db1", "uid", nil)
+	drifts := compareSchema(dao, table, reflect.TypeOf(driftUser{}))
+
+	want := []string{
+		`[db1] users: SQLDao pk "uid", table primary key (id)`,
+		"[db1] users.email (driftUser.Email): column nullable, field type string cannot hold NULL",
+		"[db1] users.age (driftUser.Age): column type varchar(8), field type int",
+		"[db1] users.removed (driftUser.Removed): column not found, field always zero",
+	}
+	got := make([]string, len(drifts))
+	for i, d := range drifts {
+		got[i] = d.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareSchema() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	dao = NewSQLDao("users", "db1", "id", nil)
+	table.Columns = table.Columns[:1]
+	if drifts := compareSchema(dao, table, reflect.TypeOf(struct {
+		ID int64 `ddb:"id"`
+	}{})); len(drifts) != 0 {
+		t.Errorf("compareSchema() = %v, want none", drifts)
+	}
+}
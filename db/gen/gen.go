@@ -0,0 +1,326 @@
+// 根据数据库表结构生成记录结构体、字段常量及类型化的 SQLDao
+//
+// 生成的文件以 _gen.go 结尾并带有 "DO NOT EDIT" 标记, 重新生成时只覆盖带标记的文件,
+// 手写的方法放在同一个包的其他文件中即可保留
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/zhouchang2017/toolkit/db/schema"
+)
+
+const header = "// Code generated by toolkit gen. DO NOT EDIT."
+
+var generated = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+type Options struct {
+	// 数据库连接名称
+	Handle string
+	// 输出目录
+	Dir string
+	// 包名, 默认为输出目录名
+	Package string
+	// 需要生成的表, 为空时生成全部
+	Tables []string
+	// 生成 json tag
+	JSONTag bool
+}
+
+// 生成代码并写入文件, 返回写入的文件
+func Generate(ctx context.Context, opt Options) ([]string, error) {
+	opt, names, err := prepare(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opt.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		file, src, err := render(ctx, opt, name)
+		if err != nil {
+			return files, err
+		}
+		if err := write(file, src); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// 对比生成的文件与当前表结构, 返回缺失或内容不一致的文件,
+// 未指定 Tables 时目录中没有对应表的生成文件也视为不一致
+func Diff(ctx context.Context, opt Options) ([]string, error) {
+	opt, names, err := prepare(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	expected := map[string]bool{}
+	for _, name := range names {
+		file, src, err := render(ctx, opt, name)
+		if err != nil {
+			return files, err
+		}
+		expected[file] = true
+		content, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return files, err
+		}
+		if !bytes.Equal(content, src) {
+			files = append(files, file)
+		}
+	}
+	if len(opt.Tables) > 0 {
+		return files, nil
+	}
+	existing, err := filepath.Glob(filepath.Join(opt.Dir, "*_gen.go"))
+	if err != nil {
+		return files, err
+	}
+	for _, file := range existing {
+		if !expected[file] && isGenerated(file) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// 补全默认参数并返回需要生成的表
+func prepare(ctx context.Context, opt Options) (Options, []string, error) {
+	if opt.Dir == "" {
+		opt.Dir = "."
+	}
+	if opt.Package == "" {
+		abs, err := filepath.Abs(opt.Dir)
+		if err != nil {
+			return opt, nil, err
+		}
+		opt.Package = strings.Replace(strings.ToLower(filepath.Base(abs)), "-", "_", -1)
+	}
+	names := opt.Tables
+	if len(names) == 0 {
+		tables, err := schema.Tables(ctx, opt.Handle)
+		if err != nil {
+			return opt, nil, err
+		}
+		for _, t := range tables {
+			names = append(names, t.Name)
+		}
+	}
+	return opt, names, nil
+}
+
+func render(ctx context.Context, opt Options, name string) (string, []byte, error) {
+	t, err := schema.Describe(ctx, opt.Handle, name)
+	if err != nil {
+		return "", nil, err
+	}
+	src, err := Render(opt.Package, t, opt.JSONTag)
+	if err != nil {
+		return "", nil, fmt.Errorf("gen table [%s] err:%w", name, err)
+	}
+	return filepath.Join(opt.Dir, strings.ToLower(name)+"_gen.go"), src, nil
+}
+
+// 文件是否带有生成标记
+func isGenerated(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if generated.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+	}
+	return false
+}
+
+// 仅覆盖生成的文件, 避免覆盖手写代码
+func write(file string, src []byte) error {
+	if _, err := os.Stat(file); err == nil {
+		if !isGenerated(file) {
+			return fmt.Errorf("gen: %s is not a generated file, refuse to overwrite", file)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(file, src, 0644)
+}
+
+type field struct {
+	Name    string
+	Column  string
+	Const   string
+	Type    string
+	Tag     string
+	Comment string
+}
+
+type tableData struct {
+	Header  string
+	Package string
+	Imports []string
+	Table   string
+	Comment string
+	Record  string
+	Fields  []field
+	// 单一主键时生成 FindByKey
+	PK     *field
+	PKName string
+}
+
+// 生成单个表的代码
+func Render(pkg string, t *schema.Table, jsonTag bool) ([]byte, error) {
+	record := camel(singular(t.Name))
+	data := tableData{
+		Header:  header,
+		Package: pkg,
+		Table:   t.Name,
+		Comment: strings.Replace(t.Comment, "\n", " ", -1),
+		Record:  record,
+	}
+	imports := map[string]bool{"context": true}
+	used := map[string]int{}
+	for _, c := range t.Columns {
+		name := camel(c.Name)
+		if used[name]++; used[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, used[name])
+		}
+		typ := c.GoType()
+		switch {
+		case strings.HasPrefix(typ, "sql."):
+			imports["database/sql"] = true
+		case typ == "time.Time":
+			imports["time"] = true
+		}
+		tag := fmt.Sprintf(`ddb:"%s"`, c.Name)
+		if jsonTag {
+			tag += fmt.Sprintf(` json:"%s"`, c.Name)
+		}
+		data.Fields = append(data.Fields, field{
+			Name:    name,
+			Column:  c.Name,
+			Const:   record + "Column" + name,
+			Type:    typ,
+			Tag:     tag,
+			Comment: strings.Replace(c.Comment, "\n", " ", -1),
+		})
+	}
+	data.PKName = `""`
+	if pk := t.PrimaryKey(); len(pk) == 1 {
+		for i := range data.Fields {
+			if data.Fields[i].Column == pk[0] {
+				f := data.Fields[i]
+				c, _ := t.Column(pk[0])
+				c.Nullable = false
+				f.Type = c.GoType()
+				data.PK, data.PKName = &f, f.Const
+			}
+		}
+	}
+	for imp := range imports {
+		data.Imports = append(data.Imports, imp)
+	}
+	sort.Strings(data.Imports)
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var tpl = template.Must(template.New("table").Parse(`{{.Header}}
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/zhouchang2017/toolkit/db"
+)
+
+const {{.Record}}Table = "{{.Table}}"
+
+// {{.Table}} 表字段
+const (
+{{- range .Fields}}
+	{{.Const}} = "{{.Column}}"
+{{- end}}
+)
+
+var {{.Record}}Columns = []string{
+{{- range .Fields}}
+	{{.Const}},
+{{- end}}
+}
+
+{{if .Comment}}// {{.Comment}}{{else}}// {{.Table}} 表记录{{end}}
+type {{.Record}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`{{.Tag}}`" + `{{if .Comment}} // {{.Comment}}{{end}}
+{{- end}}
+}
+
+// {{.Table}} 表的 SQLDao, 手写方法放在其他文件中以免重新生成时被覆盖
+type {{.Record}}Dao struct {
+	*db.SQLDao
+}
+
+func New{{.Record}}Dao(handleName string, opt *db.SQLDaoOption) *{{.Record}}Dao {
+	dao := db.NewSQLDao({{.Record}}Table, handleName, {{.PKName}}, opt)
+	db.RegisterRecord(dao, {{.Record}}{})
+	return &{{.Record}}Dao{SQLDao: dao}
+}
+{{if .PK}}
+// 通过主键查询
+func (d *{{.Record}}Dao) FindByKey(ctx context.Context, key {{.PK.Type}}) (*{{.Record}}, error) {
+	record := &{{.Record}}{}
+	if err := d.SQLDao.FindByKey(ctx, key, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+{{end}}
+// 通过条件查询第一个
+func (d *{{.Record}}Dao) First(ctx context.Context, where map[string]interface{}) (*{{.Record}}, error) {
+	record := &{{.Record}}{}
+	if err := d.SQLDao.First(ctx, where, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// 通过条件查询集合
+func (d *{{.Record}}Dao) Find(ctx context.Context, where map[string]interface{}, offset uint, limit uint) ([]{{.Record}}, error) {
+	records := make([]{{.Record}}, 0)
+	if err := d.SQLDao.Find(ctx, where, offset, limit, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+`))
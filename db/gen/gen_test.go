@@ -0,0 +1,116 @@
+package gen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/db/schema"
+)
+
+func TestCamel(t *testing.T) {
+	tests := map[string]string{
+		"user_id":    "UserID",
+		"created_at": "CreatedAt",
+		"api_url":    "APIURL",
+		"2fa":        "X2fa",
+		"name":       "Name",
+	}
+	for in, want := range tests {
+		if got := camel(in); got != want {
+			t.Errorf("camel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"users":      "user",
+		"categories": "category",
+		"addresses":  "address",
+		"boxes":      "box",
+		"status":     "status",
+		"class":      "class",
+		"user_info":  "user_info",
+	}
+	for in, want := range tests {
+		if got := singular(in); got != want {
+			t.Errorf("singular(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	table := &schema.Table{
+		Name:    "users",
+		Comment: "用户",
+		Columns: []schema.Column{
+			{Name: "id", DataType: "bigint", ColumnType: "bigint(20) unsigned", Primary: true, AutoIncrement: true},
+			{Name: "name", DataType: "varchar", ColumnType: "varchar(64)", Comment: "昵称"},
+			{Name: "email", DataType: "varchar", ColumnType: "varchar(128)", Nullable: true},
+			{Name: "enabled", DataType: "tinyint", ColumnType: "tinyint(1)"},
+			{Name: "created_at", DataType: "datetime", ColumnType: "datetime"},
+		},
+	}
+	src, err := Render("model", table, true)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		header,
+		"package model",
+		`"database/sql"`,
+		`"time"`,
+		`const UserTable = "users"`,
+		`UserColumnCreatedAt = "created_at"`,
+		"// 用户\ntype User struct {",
+		"ID        uint64         `ddb:\"id\" json:\"id\"`",
+		"Name      string         `ddb:\"name\" json:\"name\"` // 昵称",
+		"Email     sql.NullString `ddb:\"email\" json:\"email\"`",
+		"Enabled   bool",
+		"CreatedAt time.Time",
+		"db.NewSQLDao(UserTable, handleName, UserColumnID, opt)",
+		"db.RegisterRecord(dao, User{})",
+		"FindByKey(ctx context.Context, key uint64) (*User, error)",
+		"Find(ctx context.Context, where map[string]interface{}, offset uint, limit uint) ([]User, error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Render() missing %q\n%s", want, code)
+		}
+	}
+
+	// 联合主键不生成 FindByKey
+	table.Columns[1].Primary = true
+	src, err = Render("model", table, false)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if code := string(src); strings.Contains(code, "FindByKey") || strings.Contains(code, "json:") {
+		t.Errorf("Render() composite key\n%s", code)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "users_gen.go")
+	if err := write(file, []byte(header+"\n\npackage model\n")); err != nil {
+		t.Fatalf("write() new file error = %v", err)
+	}
+	if err := write(file, []byte(header+"\n\npackage model\n\n// v2\n")); err != nil {
+		t.Fatalf("write() generated file error = %v", err)
+	}
+	if err := ioutil.WriteFile(file, []byte("package model\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(file, []byte(header+"\n\npackage model\n")); err == nil {
+		t.Error("write() handwritten file should fail")
+	}
+}
@@ -0,0 +1,48 @@
+package gen
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 常见缩写, 按 go 命名习惯保持大写
+var initialisms = map[string]bool{
+	"ID": true, "IP": true, "URL": true, "URI": true, "UID": true, "UUID": true,
+	"API": true, "HTTP": true, "JSON": true, "SQL": true, "SSL": true, "TLS": true,
+}
+
+// 下划线命名转驼峰, user_id => UserID
+func camel(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '.'
+	}) {
+		if upper := strings.ToUpper(part); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// 表名转单数形式的结构体名称, users => User
+func singular(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"),
+		strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss") && !strings.HasSuffix(lower, "us") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+	return name
+}
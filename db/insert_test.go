@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+)
+
+// Insert 及 TXInsert 按单条记录生成语句, 曾因 make(..., 0, 1) 后按下标赋值而 panic, 不依赖 cgo
+func TestSQLDao_insertSingleRow(t *testing.T) {
+	c := mysqlconfig.Configs{"insert": mysqlconfig.Config{Driver: "toolkit-db-fake", Host: "insert"}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+	defer fake.Reset()
+	fake.Handle(func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+		if !strings.HasPrefix(query, "INSERT INTO users") || len(args) != 1 || args[0].Value != "tom" {
+			t.Errorf("query = %s %v, want one row", query, args)
+		}
+		return &fakesql.Result{LastInsertID: 7, RowsAffected: 1}, nil
+	})
+
+	dao := NewSQLDao("users", "insert", "id", nil)
+	ctx := context.Background()
+	if id, err := dao.Insert(ctx, map[string]interface{}{"name": "tom"}); err != nil || id != 7 {
+		t.Errorf("Insert() = %d, %v, want 7", id, err)
+	}
+	db, err := mysqlconfig.Get("insert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := mysqlconfig.BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := dao.TXInsert(ctx, tx.Tx, map[string]interface{}{"name": "tom"}); err != nil || id != 7 {
+		t.Errorf("TXInsert() = %d, %v, want 7", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+}
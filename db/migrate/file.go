@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// 迁移文件名 <version>_<name>.up.sql / <version>_<name>.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFile   string
+	DownFile string
+	// up 文件的 sha256
+	Checksum string
+}
+
+// 读取目录下的迁移文件, 按版本号升序
+func Load(dir string) ([]*Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations := map[int64]*Migration{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(f.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %s", f.Name(), err.Error())
+		}
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d has different names: %s, %s", version, m.Name, match[2])
+		}
+		path := filepath.Join(dir, f.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up, m.UpFile = string(content), path
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down, m.DownFile = string(content), path
+		}
+	}
+
+	res := make([]*Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.UpFile == "" {
+			return nil, fmt.Errorf("migration %d_%s missing up file", m.Version, m.Name)
+		}
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+const (
+	statementBegin = "+migrate StatementBegin"
+	statementEnd   = "+migrate StatementEnd"
+)
+
+// postgres 的 dollar quote 标记, 如 $$、$body$
+var dollarTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// 按分号拆分语句, 忽略引号及注释中的分号
+// # 注释及反斜杠转义只用于 mysql, $$ 引用只用于 postgres,
+// -- +migrate StatementBegin 与 -- +migrate StatementEnd 之间的内容作为一条语句, 用于存储过程、触发器等包含分号的语句
+func splitStatements(script string, dialect string) []string {
+	mysql, postgres := dialect == mysqlconfig.DialectMySQL, dialect == mysqlconfig.DialectPostgres
+	var stmts []string
+	var buf strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(buf.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		buf.Reset()
+	}
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case quote != 0:
+			buf.WriteByte(ch)
+			if ch == '\\' && mysql && quote != '`' && i+1 < len(script) {
+				i++
+				buf.WriteByte(script[i])
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			buf.WriteByte(ch)
+		case ch == '$' && postgres && dollarTag.MatchString(script[i:]):
+			tag := dollarTag.FindString(script[i:])
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				buf.WriteString(script[i:])
+				i = len(script)
+			} else {
+				buf.WriteString(script[i : i+len(tag)+end+len(tag)])
+				i += len(tag) + end + len(tag) - 1
+			}
+		case ch == '-' && strings.HasPrefix(script[i:], "--"), ch == '#' && mysql:
+			// 单行注释
+			end := strings.IndexByte(script[i:], '\n')
+			line := script[i:]
+			if end >= 0 {
+				line = script[i : i+end]
+			}
+			if ch == '-' && strings.TrimSpace(line[2:]) == statementBegin {
+				flush()
+				body, next := statementBlock(script[i+len(line):])
+				buf.WriteString(body)
+				flush()
+				i += len(line) + next - 1
+				continue
+			}
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+				buf.WriteByte('\n')
+			}
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case ch == ';':
+			flush()
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// StatementBegin 之后直到 StatementEnd 行的内容, 返回内容及 StatementEnd 行之后的位置, 没有 StatementEnd 时到脚本结尾
+func statementBlock(script string) (body string, next int) {
+	for pos := 0; pos < len(script); {
+		end := strings.IndexByte(script[pos:], '\n')
+		line := script[pos:]
+		if end >= 0 {
+			line = script[pos : pos+end+1]
+		}
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "--") && strings.TrimSpace(trimmed[2:]) == statementEnd {
+			return script[:pos], pos + len(line)
+		}
+		pos += len(line)
+	}
+	return script, len(script)
+}
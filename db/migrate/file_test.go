@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"2_add_email.up.sql":      "ALTER TABLE users ADD email VARCHAR(64);",
+		"1_create_users.up.sql":   "CREATE TABLE users (id INT);",
+		"1_create_users.down.sql": "DROP TABLE users;",
+		"readme.md":               "ignored",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Load() = %+v", migrations)
+	}
+	if migrations[0].Name != "create_users" || migrations[0].Down != "DROP TABLE users;" || migrations[1].DownFile != "" {
+		t.Errorf("Load()[0] = %+v", migrations[0])
+	}
+	if len(migrations[0].Checksum) != 64 || migrations[0].Checksum == migrations[1].Checksum {
+		t.Errorf("Load() checksum = %s", migrations[0].Checksum)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		script  string
+		want    []string
+	}{
+		{"mysql", mysqlconfig.DialectMySQL, `-- create table; with comment
+CREATE TABLE t (a VARCHAR(8) DEFAULT ';');
+/* block; comment */
+INSERT INTO t VALUES ('it''s;'), ("x\";y");
+# trailing
+UPDATE t SET a = 'b'`, []string{
+			"CREATE TABLE t (a VARCHAR(8) DEFAULT ';')",
+			`INSERT INTO t VALUES ('it''s;'), ("x\";y")`,
+			"UPDATE t SET a = 'b'",
+		}},
+		{"postgres json operators", mysqlconfig.DialectPostgres,
+			"SELECT data #> '{a,b}', data #>> '{c}' FROM t WHERE flags # 1 = 0; SELECT 'C:\\'; SELECT 1",
+			[]string{"SELECT data #> '{a,b}', data #>> '{c}' FROM t WHERE flags # 1 = 0", "SELECT 'C:\\'", "SELECT 1"}},
+		{"postgres dollar quote", mysqlconfig.DialectPostgres, `CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+CREATE FUNCTION g() RETURNS int AS $body$ BEGIN RETURN $1; END; $body$ LANGUAGE plpgsql;
+SELECT $1`, []string{
+			"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql",
+			"CREATE FUNCTION g() RETURNS int AS $body$ BEGIN RETURN $1; END; $body$ LANGUAGE plpgsql",
+			"SELECT $1",
+		}},
+		{"mysql dollar", mysqlconfig.DialectMySQL, "SELECT $$a; SELECT b$$", []string{"SELECT $$a", "SELECT b$$"}},
+		{"statement block", mysqlconfig.DialectMySQL, `CREATE TABLE t (a INT);
+-- +migrate StatementBegin
+CREATE TRIGGER t_ai AFTER INSERT ON t FOR EACH ROW
+BEGIN
+  UPDATE c SET n = n + 1;
+  UPDATE d SET n = n + 1;
+END;
+-- +migrate StatementEnd
+DROP TABLE c;`, []string{
+			"CREATE TABLE t (a INT)",
+			"CREATE TRIGGER t_ai AFTER INSERT ON t FOR EACH ROW\nBEGIN\n  UPDATE c SET n = n + 1;\n  UPDATE d SET n = n + 1;\nEND;",
+			"DROP TABLE c",
+		}},
+		{"unterminated block", mysqlconfig.DialectSQLite, "SELECT 1;\n--  +migrate StatementBegin\nSELECT 2; SELECT 3;\n", []string{"SELECT 1", "SELECT 2; SELECT 3;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script, tt.dialect); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
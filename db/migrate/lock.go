@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+var ErrLocked = errors.New("migration locked by another runner")
+
+func (m *Migrator) lockName() string {
+	return "toolkit_migrate:" + m.opt.Table
+}
+
+// 获取迁移锁, 防止多个执行者同时迁移, 返回释放锁的方法
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	switch m.dialect {
+	case mysqlconfig.DialectMySQL:
+		var ok sql.NullInt64
+		timeout := int64(math.Ceil(m.opt.LockTimeout.Seconds()))
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.lockName(), timeout).Scan(&ok); err != nil {
+			return nil, err
+		}
+		if ok.Int64 != 1 {
+			return nil, ErrLocked
+		}
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", m.lockName()); err != nil {
+				log.Logger.Errorf("migrate [%s] release lock err:%s", m.handle, err.Error())
+			}
+		}, nil
+	case mysqlconfig.DialectPostgres:
+		h := fnv.New64a()
+		h.Write([]byte(m.lockName()))
+		key := int64(h.Sum64())
+		deadline := time.Now().Add(m.opt.LockTimeout)
+		for {
+			var ok bool
+			if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+				return nil, err
+			}
+			if ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil, ErrLocked
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+				log.Logger.Errorf("migrate [%s] release lock err:%s", m.handle, err.Error())
+			}
+		}, nil
+	default:
+		// sqlite 写操作由数据库文件锁串行化
+		return func() {}, nil
+	}
+}
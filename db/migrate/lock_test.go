@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+)
+
+var fake = &fakesql.Driver{}
+
+func init() {
+	sql.Register("toolkit-migrate-fake", fake)
+	mysqlconfig.RegisterDriver("toolkit-migrate-fake", mysqlconfig.DialectMySQL, "", func(c mysqlconfig.Config) string {
+		return c.Host
+	})
+}
+
+func names(migrations []*Migration) []string {
+	res := make([]string, len(migrations))
+	for i, mig := range migrations {
+		res[i] = mig.Name
+	}
+	return res
+}
+
+// 版本记录表不存在
+var noTable = &fakesql.Result{Columns: []string{"n"}, Rows: [][]driver.Value{{int64(0)}}}
+
+// 统计语句前缀的执行次数
+func count(queries []string, prefix string) int {
+	n := 0
+	for _, q := range queries {
+		if strings.HasPrefix(q, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMigrator_Locked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "1_users.up.sql"), []byte("CREATE TABLE users (id INT);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := mysqlconfig.Configs{"locked": mysqlconfig.Config{Driver: "toolkit-migrate-fake", Host: "locked"}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer c.Close()
+	defer fake.Reset()
+
+	var mu sync.Mutex
+	held := true
+	handler := func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return noTable, nil
+		}
+		if !strings.HasPrefix(query, "SELECT GET_LOCK") {
+			return nil, nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ok := int64(1)
+		if held {
+			ok = 0
+		}
+		return &fakesql.Result{Columns: []string{"ok"}, Rows: [][]driver.Value{{ok}}}, nil
+	}
+	fake.Handle(handler)
+	ctx := context.Background()
+
+	if _, err := New("locked", Options{Dir: dir}).Up(ctx, 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Up() error = %v, want ErrLocked", err)
+	}
+	queries := fake.Queries()
+	if count(queries, "CREATE TABLE users") != 0 || count(queries, "SELECT RELEASE_LOCK") != 0 {
+		t.Errorf("locked run executed %q", queries)
+	}
+
+	// 获取锁后执行完成时释放
+	fake.Reset()
+	mu.Lock()
+	held = false
+	mu.Unlock()
+	fake.Handle(handler)
+	if plan, err := New("locked", Options{Dir: dir}).Up(ctx, 0); err != nil || len(plan) != 1 {
+		t.Fatalf("Up() = %v, %v", names(plan), err)
+	}
+	queries = fake.Queries()
+	if count(queries, "CREATE TABLE users") != 1 || count(queries, "SELECT RELEASE_LOCK") != 1 {
+		t.Errorf("executed %q, want users created and lock released once", queries)
+	}
+
+	// 只查看执行计划时不加锁, 不写入
+	fake.Reset()
+	fake.Handle(func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return noTable, nil
+		case strings.HasPrefix(query, "SELECT GET_LOCK"), strings.HasPrefix(query, "CREATE"):
+			return nil, errors.New("dry run executed " + query)
+		}
+		return nil, nil
+	})
+	if plan, err := New("locked", Options{Dir: dir, DryRun: true}).Up(ctx, 0); err != nil || len(plan) != 1 {
+		t.Errorf("dry run Up() = %v, %v", names(plan), err)
+	}
+}
@@ -0,0 +1,287 @@
+// 版本化 sql 迁移, 在 mysqlconfig 的指定连接上执行
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	defaultTable       = "schema_migrations"
+	defaultLockTimeout = time.Minute
+)
+
+var ErrDrift = errors.New("applied migrations have been modified")
+
+type Options struct {
+	// 迁移文件目录
+	Dir string
+	// 版本记录表, 默认 schema_migrations
+	Table string
+	// 仅返回执行计划, 不执行也不写入数据库
+	DryRun bool
+	// 等待其他执行者释放锁的最长时间, 默认 1m
+	LockTimeout time.Duration
+	// 已执行的迁移文件被修改时仍然执行
+	IgnoreDrift bool
+}
+
+// 迁移状态
+type Status struct {
+	Migration *Migration
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// 已执行的文件内容被修改
+	Drift bool
+	// 已执行但文件不存在
+	Missing bool
+}
+
+type Migrator struct {
+	handle  string
+	dialect string
+	opt     Options
+}
+
+func New(handle string, opt Options) *Migrator {
+	if opt.Table == "" {
+		opt.Table = defaultTable
+	}
+	if opt.LockTimeout <= 0 {
+		opt.LockTimeout = defaultLockTimeout
+	}
+	return &Migrator{handle: handle, dialect: mysqlconfig.Dialect(handle), opt: opt}
+}
+
+type applied struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// 占位符
+func (m *Migrator) bind(i int) string {
+	if m.dialect == mysqlconfig.DialectPostgres {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.opt.Table+" ("+
+		"version BIGINT NOT NULL PRIMARY KEY, "+
+		"name VARCHAR(255) NOT NULL, "+
+		"checksum CHAR(64) NOT NULL, "+
+		"applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	return err
+}
+
+// 版本记录表是否存在, 只查看时不创建
+func (m *Migrator) tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	switch m.dialect {
+	case mysqlconfig.DialectPostgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	case mysqlconfig.DialectSQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+	var n int
+	err := conn.QueryRowContext(ctx, query, m.opt.Table).Scan(&n)
+	return n > 0, err
+}
+
+// 已执行的版本, 版本记录表不存在时为空
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]applied, error) {
+	res := map[int64]applied{}
+	if exists, err := m.tableExists(ctx, conn); err != nil || !exists {
+		return res, err
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM "+m.opt.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a applied
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		res[a.version] = a
+	}
+	return res, rows.Err()
+}
+
+func (m *Migrator) conn(ctx context.Context) (*sql.Conn, error) {
+	db, err := mysqlconfig.Get(m.handle)
+	if err != nil {
+		return nil, err
+	}
+	return db.Conn(ctx)
+}
+
+// 迁移文件与已执行版本的对比, 不修改数据库
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return m.status(ctx, conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]Status, error) {
+	migrations, err := Load(m.opt.Dir)
+	if err != nil {
+		return nil, err
+	}
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Status, 0, len(migrations))
+	for _, mig := range migrations {
+		st := Status{Migration: mig, Version: mig.Version, Name: mig.Name}
+		if a, ok := done[mig.Version]; ok {
+			st.Applied, st.AppliedAt = true, a.appliedAt
+			st.Drift = a.checksum != mig.Checksum
+			delete(done, mig.Version)
+		}
+		res = append(res, st)
+	}
+	for _, a := range done {
+		res = append(res, Status{Version: a.version, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Missing: true})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// 执行版本号不大于 target 的未执行迁移, target 为 0 时执行全部
+// 任一已执行的迁移被修改或文件不存在时返回 ErrDrift, 与 target 无关
+func (m *Migrator) Up(ctx context.Context, target int64) ([]*Migration, error) {
+	return m.run(ctx, func(statuses []Status) ([]*Migration, error) {
+		var drift []string
+		plan := make([]*Migration, 0)
+		for _, st := range statuses {
+			if st.Drift || st.Missing {
+				drift = append(drift, fmt.Sprintf("%d_%s", st.Version, st.Name))
+			}
+			if st.Applied || st.Migration == nil {
+				continue
+			}
+			if target > 0 && st.Version > target {
+				continue
+			}
+			plan = append(plan, st.Migration)
+		}
+		if len(drift) > 0 && !m.opt.IgnoreDrift {
+			return nil, fmt.Errorf("%w: %s", ErrDrift, strings.Join(drift, ", "))
+		}
+		return plan, nil
+	}, true)
+}
+
+// 回滚版本号大于 target 的已执行迁移, 按版本倒序
+func (m *Migrator) Down(ctx context.Context, target int64) ([]*Migration, error) {
+	return m.run(ctx, func(statuses []Status) ([]*Migration, error) {
+		plan := make([]*Migration, 0)
+		for i := len(statuses) - 1; i >= 0; i-- {
+			st := statuses[i]
+			if !st.Applied || st.Version <= target {
+				continue
+			}
+			if st.Missing {
+				return nil, fmt.Errorf("migration %d_%s applied but file not found", st.Version, st.Name)
+			}
+			if st.Migration.DownFile == "" {
+				return nil, fmt.Errorf("migration %d_%s missing down file", st.Version, st.Name)
+			}
+			plan = append(plan, st.Migration)
+		}
+		return plan, nil
+	}, false)
+}
+
+func (m *Migrator) run(ctx context.Context, planner func([]Status) ([]*Migration, error), up bool) ([]*Migration, error) {
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 只查看执行计划时不加锁也不创建版本记录表, 表不存在时所有迁移都未执行
+	if !m.opt.DryRun {
+		unlock, err := m.lock(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	statuses, err := m.status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planner(statuses)
+	if err != nil || m.opt.DryRun {
+		return plan, err
+	}
+
+	for i, mig := range plan {
+		start := time.Now()
+		if err := m.apply(ctx, conn, mig, up); err != nil {
+			return plan[:i], fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		log.Logger.Infof("migrate [%s] %d_%s %s done, cost %s", m.handle, mig.Version, mig.Name, direction, time.Since(start))
+	}
+	return plan, nil
+}
+
+// 在事务中执行迁移并更新版本记录, mysql 的 ddl 会隐式提交
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig *Migration, up bool) (err error) {
+	script := mig.Up
+	if !up {
+		script = mig.Down
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, stmt := range splitStatements(script, m.dialect) {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES (%s, %s, %s)",
+			m.opt.Table, m.bind(1), m.bind(2), m.bind(3)), mig.Version, mig.Name, mig.Checksum)
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.opt.Table, m.bind(1)), mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,194 @@
+//go:build cgo
+// +build cgo
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// 写入迁移文件并初始化测试连接, 返回迁移目录及清理方法
+func setup(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := mysqlconfig.Configs{"migrate": mysqlconfig.Config{Driver: "sqlite3", DB: filepath.Join(dir, "test.db")}}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	return dir, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func exec(t *testing.T, query string, args ...interface{}) {
+	db, err := mysqlconfig.Get("migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// 按 sql 查询单列结果
+func column(t *testing.T, query string) []string {
+	db, err := mysqlconfig.Get("migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+	res := make([]string, 0)
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, v.String)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func appliedVersions(t *testing.T) []string {
+	return column(t, "SELECT version FROM schema_migrations ORDER BY version")
+}
+
+// 迁移创建的表及索引
+func objects(t *testing.T) []string {
+	return column(t, "SELECT name FROM sqlite_master WHERE name NOT LIKE 'schema_migrations%' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+var testFiles = map[string]string{
+	"1_users.up.sql":     "CREATE TABLE users (id INT);",
+	"1_users.down.sql":   "DROP TABLE users;",
+	"2_orders.up.sql":    "CREATE TABLE orders (id INT); CREATE INDEX idx ON orders (id);",
+	"2_orders.down.sql":  "DROP TABLE orders;",
+	"3_email.up.sql":     "CREATE TABLE emails (user_id INT, email VARCHAR(64));",
+	"3_email.down.sql":   "DROP TABLE emails;",
+	"4_no_down.up.sql":   "ALTER TABLE users ADD COLUMN age INT;",
+	"5_broken.up.sql":    "CREATE TABLE broken (id INT); SELECT FAIL;",
+	"5_broken.down.sql":  "SELECT 1;",
+	"6_pending.up.sql":   "SELECT 1;",
+	"6_pending.down.sql": "SELECT 1;",
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	dir, cleanup := setup(t, testFiles)
+	defer cleanup()
+	ctx := context.Background()
+
+	plan, err := New("migrate", Options{Dir: dir, DryRun: true}).Up(ctx, 2)
+	if err != nil || !reflect.DeepEqual(names(plan), []string{"users", "orders"}) {
+		t.Fatalf("dry run Up(2) = %v, %v", names(plan), err)
+	}
+	if statuses, err := New("migrate", Options{Dir: dir}).Status(ctx); err != nil || len(statuses) != 6 || statuses[0].Applied {
+		t.Fatalf("Status() before migrating = %+v, %v", statuses, err)
+	}
+	// 只查看时不创建版本记录表
+	if got := column(t, "SELECT name FROM sqlite_master"); len(got) != 0 {
+		t.Fatalf("dry run created %v", got)
+	}
+
+	m := New("migrate", Options{Dir: dir})
+	if plan, err = m.Up(ctx, 2); err != nil || len(plan) != 2 {
+		t.Fatalf("Up(2) = %v, %v", names(plan), err)
+	}
+	if plan, err = New("migrate", Options{Dir: dir, DryRun: true}).Up(ctx, 0); err != nil || len(plan) != 4 {
+		t.Fatalf("dry run Up(0) = %v, %v, want 4 pending", names(plan), err)
+	}
+	if got, want := objects(t), []string{"idx", "orders", "users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objects = %q, want %q", got, want)
+	}
+
+	// 执行失败时返回已执行的迁移, 失败的版本回滚且不记录
+	plan, err = m.Up(ctx, 0)
+	if err == nil || !strings.Contains(err.Error(), "5_broken") || !reflect.DeepEqual(names(plan), []string{"email", "no_down"}) {
+		t.Fatalf("Up(0) = %v, %v, want failure at 5_broken", names(plan), err)
+	}
+	if got := appliedVersions(t); !reflect.DeepEqual(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("applied = %v, want [1 2 3 4]", got)
+	}
+	if got := column(t, "SELECT name FROM sqlite_master WHERE name = 'broken'"); len(got) != 0 {
+		t.Errorf("failed migration left %v", got)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 6 || !statuses[3].Applied || statuses[4].Applied {
+		t.Fatalf("Status() = %+v, %v", statuses, err)
+	}
+
+	// 回滚到 1, 按版本倒序
+	if plan, err = m.Down(ctx, 2); err == nil || !strings.Contains(err.Error(), "4_no_down missing down file") {
+		t.Errorf("Down(2) = %v, %v, want missing down file", names(plan), err)
+	}
+	exec(t, "DELETE FROM schema_migrations WHERE version = 4")
+	if plan, err = m.Down(ctx, 1); err != nil || !reflect.DeepEqual(names(plan), []string{"email", "orders"}) {
+		t.Fatalf("Down(1) = %v, %v", names(plan), err)
+	}
+	if got := appliedVersions(t); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("applied = %v, want [1]", got)
+	}
+	if got, want := objects(t), []string{"users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objects = %q, want %q", got, want)
+	}
+}
+
+func TestMigrator_Drift(t *testing.T) {
+	dir, cleanup := setup(t, testFiles)
+	defer cleanup()
+	ctx := context.Background()
+
+	m := New("migrate", Options{Dir: dir})
+	if _, err := m.Up(ctx, 1); err != nil {
+		t.Fatalf("Up(1) error = %v", err)
+	}
+	// 版本 3 在 2 之前执行后被修改, 只执行到 2 时同样检查
+	exec(t, "INSERT INTO schema_migrations (version, name, checksum) VALUES (3, 'email', 'modified')")
+	if _, err := m.Up(ctx, 2); !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "3_email") {
+		t.Fatalf("Up(2) error = %v, want ErrDrift on 3_email", err)
+	}
+	if got := appliedVersions(t); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("applied = %v, want [1 3]", got)
+	}
+
+	// 已执行但文件被删除
+	exec(t, "DELETE FROM schema_migrations WHERE version = 3")
+	exec(t, "INSERT INTO schema_migrations (version, name, checksum) VALUES (9, 'gone', 'x')")
+	statuses, err := m.Status(ctx)
+	if err != nil || !statuses[len(statuses)-1].Missing {
+		t.Fatalf("Status() = %+v, %v, want last missing", statuses, err)
+	}
+	if _, err := m.Up(ctx, 2); !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "9_gone") {
+		t.Errorf("Up(2) error = %v, want ErrDrift on 9_gone", err)
+	}
+
+	plan, err := New("migrate", Options{Dir: dir, IgnoreDrift: true}).Up(ctx, 2)
+	if err != nil || !reflect.DeepEqual(names(plan), []string{"orders"}) {
+		t.Errorf("Up(2) ignoring drift = %v, %v", names(plan), err)
+	}
+}
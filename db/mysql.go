@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/didi/gendry/builder"
 	"github.com/didi/gendry/scanner"
 	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
@@ -32,12 +33,21 @@ type SQLDao struct {
 	defaultSelect []string
 	pageSize      int64
 	pk            string
+	sharding      *ShardRule
+	partition     *PartitionRule
+	cache         *daoCache
 }
 
 type SQLDaoOption struct {
 	SelectOrder string
 	Select      []string
 	PageSize    int64
+	// 分库分表规则, 为空时不分片
+	Sharding *ShardRule
+	// 按时间分表规则, 为空时不分区
+	Partition *PartitionRule
+	// FindByKey 的 redis 缓存, 为空时不缓存
+	Cache *CacheOption
 }
 
 func NewSQLDao(tableName string, handleName string, pk string, opt *SQLDaoOption) *SQLDao {
@@ -57,6 +67,25 @@ func NewSQLDao(tableName string, handleName string, pk string, opt *SQLDaoOption
 		} else if opt.PageSize > 0 {
 			s.pageSize = opt.PageSize
 		}
+		if opt.Sharding != nil {
+			if err := opt.Sharding.validate(); err != nil {
+				panic(fmt.Sprintf("db: table [%s] %s", tableName, err.Error()))
+			}
+			s.sharding = opt.Sharding
+		}
+		if opt.Partition != nil {
+			if err := opt.Partition.validate(); err != nil {
+				panic(fmt.Sprintf("db: table [%s] %s", tableName, err.Error()))
+			}
+			s.partition = opt.Partition
+		}
+		if opt.Cache != nil {
+			cache, err := newDaoCache(tableName, opt.Cache)
+			if err != nil {
+				panic(fmt.Sprintf("db: table [%s] %s", tableName, err.Error()))
+			}
+			s.cache = cache
+		}
 	}
 	return s
 }
@@ -86,21 +115,23 @@ func (s SQLDao) first(ctx context.Context, db dbExecutor, where map[string]inter
 	}
 	where["_limit"] = []uint{0, 1}
 
-	if s.selectOrder != "" {
-		where["_order"] = s.selectOrder
+	if _, ok := where["_orderby"]; !ok && s.selectOrder != "" {
+		where["_orderby"] = s.selectOrder
 	}
 
-	cond, vals, err := builder.BuildSelect(s.tableName, where, s.defaultSelect)
+	cond, vals, err := builder.BuildSelect(s.tableName, where, s.selectFields())
 	if nil != err {
 		return err
 	}
-	row, err := db.QueryContext(ctx, cond, vals...)
-	if nil != err || nil == row {
-		return err
-	}
-	defer row.Close()
-	err = scanner.Scan(row, &record)
-	return err
+	cond, vals = s.dialect().rebind(cond, vals)
+	return s.query(ctx, db, cond, vals, func(rows *sql.Rows) error {
+		return scanner.Scan(rows, record)
+	})
+}
+
+// 查询的列, gendry 会原地为列名加引号, 并发查询各分片时不能共用
+func (s SQLDao) selectFields() []string {
+	return append([]string(nil), s.defaultSelect...)
 }
 
 // gets multiple records from table COLUMNS by condition "where"
@@ -113,8 +144,8 @@ func (s SQLDao) find(ctx context.Context, db dbExecutor, where map[string]interf
 		where = map[string]interface{}{}
 	}
 
-	if s.selectOrder != "" {
-		where["_order"] = s.selectOrder
+	if _, ok := where["_orderby"]; !ok && s.selectOrder != "" {
+		where["_orderby"] = s.selectOrder
 	}
 
 	if limit == 0 {
@@ -124,17 +155,14 @@ func (s SQLDao) find(ctx context.Context, db dbExecutor, where map[string]interf
 		where["_limit"] = []uint{offset, limit}
 	}
 
-	cond, vals, err := builder.BuildSelect(s.tableName, where, s.defaultSelect)
+	cond, vals, err := builder.BuildSelect(s.tableName, where, s.selectFields())
 	if nil != err {
 		return err
 	}
-	row, err := db.QueryContext(ctx, cond, vals...)
-	if nil != err || nil == row {
-		return err
-	}
-	defer row.Close()
-	err = scanner.Scan(row, &records)
-	return err
+	cond, vals = s.dialect().rebind(cond, vals)
+	return s.query(ctx, db, cond, vals, func(rows *sql.Rows) error {
+		return scanner.Scan(rows, records)
+	})
 }
 
 // inserts an array of data into table s.tableName
@@ -146,7 +174,13 @@ func (s SQLDao) insert(ctx context.Context, db dbExecutor, data ...map[string]in
 	if nil != err {
 		return 0, err
 	}
-	result, err := db.ExecContext(ctx, cond, vals...)
+	cond, vals = s.dialect().rebind(cond, vals)
+	if d := s.dialect(); d.returning && s.pk != "" {
+		// 不支持 LastInsertId 的驱动通过 RETURNING 获取主键
+		err = s.queryRow(ctx, db, cond+" RETURNING "+d.Quote(s.pk), vals, &id)
+		return id, err
+	}
+	result, err := s.exec(ctx, db, cond, vals)
 	if nil != err || nil == result {
 		return 0, err
 	}
@@ -167,7 +201,8 @@ func (s SQLDao) update(ctx context.Context, db dbExecutor, where, data map[strin
 	if nil != err {
 		return 0, err
 	}
-	result, err := db.ExecContext(ctx, cond, vals...)
+	cond, vals = s.dialect().rebind(cond, vals)
+	result, err := s.exec(ctx, db, cond, vals)
 	if nil != err {
 		return 0, err
 	}
@@ -188,7 +223,8 @@ func (s SQLDao) delete(ctx context.Context, db dbExecutor, where map[string]inte
 	if nil != err {
 		return 0, err
 	}
-	result, err := db.ExecContext(ctx, cond, vals...)
+	cond, vals = s.dialect().rebind(cond, vals)
+	result, err := s.exec(ctx, db, cond, vals)
 	if nil != err {
 		return 0, err
 	}
@@ -197,7 +233,14 @@ func (s SQLDao) delete(ctx context.Context, db dbExecutor, where map[string]inte
 
 // count matched records in condition "where"
 func (s SQLDao) Count(ctx context.Context, where map[string]interface{}) (count int64, err error) {
-	handler, err := s.GetDbHandler()
+	if s.routing() {
+		daos, _, err := s.route(ctx, where)
+		if err != nil {
+			return 0, err
+		}
+		return s.shardCount(ctx, daos, where)
+	}
+	handler, err := s.GetReadDbHandler(ctx)
 	if err != nil {
 		return count, err
 	}
@@ -207,26 +250,37 @@ func (s SQLDao) Count(ctx context.Context, where map[string]interface{}) (count
 	if err != nil {
 		return count, err
 	}
-
-	rows, err := handler.Query(cond, vals...)
-	if err != nil {
-		return count, err
-	}
-	defer rows.Close()
+	cond, vals = s.dialect().rebind(cond, vals)
 
 	count = 0
-	if rows.Next() {
-		err = rows.Scan(&count)
-		if err != nil {
-			return count, err
+	err = s.query(ctx, handler, cond, vals, func(rows *sql.Rows) error {
+		if rows.Next() {
+			return rows.Scan(&count)
 		}
-	}
-	return count, nil
+		return nil
+	})
+	return count, err
 }
 
-// 通过Key查询
+// 通过Key查询, 配置缓存时优先读取缓存
 func (s SQLDao) FindByKey(ctx context.Context, key interface{}, record interface{}) (err error) {
-	handler, err := s.GetDbHandler()
+	if s.cache != nil {
+		return s.cache.get(ctx, key, record, func() error {
+			return s.loadByKey(ctx, key, record)
+		})
+	}
+	return s.loadByKey(ctx, key, record)
+}
+
+func (s SQLDao) loadByKey(ctx context.Context, key interface{}, record interface{}) (err error) {
+	if s.routing() {
+		daos, _, err := s.route(ctx, s.pkCond(key))
+		if err != nil {
+			return err
+		}
+		return s.shardLookup(ctx, daos, s.pkCond(key), record)
+	}
+	handler, err := s.GetReadDbHandler(ctx)
 	if err != nil {
 		return err
 	}
@@ -235,7 +289,14 @@ func (s SQLDao) FindByKey(ctx context.Context, key interface{}, record interface
 
 // 通过条件查询第一个
 func (s SQLDao) First(ctx context.Context, where map[string]interface{}, record interface{}) (err error) {
-	handler, err := s.GetDbHandler()
+	if s.routing() {
+		daos, _, err := s.route(ctx, where)
+		if err != nil {
+			return err
+		}
+		return s.shardFirst(ctx, daos, where, record)
+	}
+	handler, err := s.GetReadDbHandler(ctx)
 	if err != nil {
 		return err
 	}
@@ -245,7 +306,14 @@ func (s SQLDao) First(ctx context.Context, where map[string]interface{}, record
 // 通过条件查询集合
 // limit < 0, 查询全部
 func (s SQLDao) Find(ctx context.Context, where map[string]interface{}, offset uint, limit uint, records interface{}) (err error) {
-	handler, err := s.GetDbHandler()
+	if s.routing() {
+		daos, _, err := s.route(ctx, where)
+		if err != nil {
+			return err
+		}
+		return s.shardFind(ctx, daos, where, offset, limit, records)
+	}
+	handler, err := s.GetReadDbHandler(ctx)
 	if err != nil {
 		return err
 	}
@@ -254,26 +322,50 @@ func (s SQLDao) Find(ctx context.Context, where map[string]interface{}, offset u
 
 // 新增记录
 func (s SQLDao) Insert(ctx context.Context, data map[string]interface{}) (id int64, err error) {
+	if s.routing() {
+		dao, err := s.routeInsert(data)
+		if err != nil {
+			return 0, err
+		}
+		return dao.Insert(ctx, data)
+	}
 	handler, err := s.GetDbHandler()
 	if err != nil {
 		return id, err
 	}
-	i := make([]map[string]interface{}, 0, 1)
-	i[0] = data
-	return s.insert(ctx, handler, i...)
+	if id, err = s.insert(ctx, handler, data); err != nil {
+		return id, err
+	}
+	s.invalidateInsert(ctx, nil, data, id)
+	return id, nil
 }
 
 // 通过Key更新
 func (s SQLDao) UpdateByKey(ctx context.Context, key interface{}, data map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWriteKey(key, data)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.UpdateByKey(ctx, key, data)
+	}
 	handler, err := s.GetDbHandler()
 	if err != nil {
 		return 0, err
 	}
+	defer s.invalidate(ctx, nil, key)
 	return s.updateByKey(ctx, handler, key, data)
 }
 
 // 通过条件更新
 func (s SQLDao) Update(ctx context.Context, where, data map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWrite(where, data)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.Update(ctx, where, data)
+	}
 	handler, err := s.GetDbHandler()
 	if err != nil {
 		return 0, err
@@ -283,15 +375,30 @@ func (s SQLDao) Update(ctx context.Context, where, data map[string]interface{})
 
 // 通过Key删除
 func (s SQLDao) DeleteByKey(ctx context.Context, key interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWriteKey(key, nil)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.DeleteByKey(ctx, key)
+	}
 	handler, err := s.GetDbHandler()
 	if err != nil {
 		return 0, err
 	}
+	defer s.invalidate(ctx, nil, key)
 	return s.deleteByKey(ctx, handler, key)
 }
 
 // 删除
 func (s SQLDao) Delete(ctx context.Context, where map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWrite(where, nil)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.Delete(ctx, where)
+	}
 	handler, err := s.GetDbHandler()
 	if err != nil {
 		return 0, err
@@ -299,27 +406,76 @@ func (s SQLDao) Delete(ctx context.Context, where map[string]interface{}) (int64
 	return s.delete(ctx, handler, where)
 }
 
+// 分片时事务需在 Shard 返回的分片连接上开启, 分区按数据或条件中的时间定位
+// 配置缓存时执行后立即删除缓存, 通过 utils.Transaction 或 mysqlconfig.BeginTx 开启的事务提交后再次删除
 // 基于事务新增记录
 func (s SQLDao) TXInsert(ctx context.Context, tx *sql.Tx, data map[string]interface{}) (id int64, err error) {
-	return s.insert(ctx, tx, data)
+	if s.routing() {
+		dao, err := s.routeInsert(data)
+		if err != nil {
+			return 0, err
+		}
+		return dao.txInsert(ctx, tx, data)
+	}
+	return s.txInsert(ctx, tx, data)
+}
+
+func (s SQLDao) txInsert(ctx context.Context, tx *sql.Tx, data map[string]interface{}) (id int64, err error) {
+	if id, err = s.insert(ctx, tx, data); err != nil {
+		return id, err
+	}
+	s.invalidateInsert(ctx, tx, data, id)
+	return id, nil
 }
 
 // 基于事务通过Key更新
 func (s SQLDao) TXUpdateByKey(ctx context.Context, tx *sql.Tx, key interface{}, data map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWriteKey(key, data)
+		if err != nil || !ok {
+			return 0, err
+		}
+		defer dao.invalidate(ctx, tx, key)
+		return dao.updateByKey(ctx, tx, key, data)
+	}
+	defer s.invalidate(ctx, tx, key)
 	return s.updateByKey(ctx, tx, key, data)
 }
 
 // 基于事务通过条件更新
 func (s SQLDao) TXUpdate(ctx context.Context, tx *sql.Tx, where, data map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWrite(where, data)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.update(ctx, tx, where, data)
+	}
 	return s.update(ctx, tx, where, data)
 }
 
 // 基于事务通过Key删除
 func (s SQLDao) TXDeleteByKey(ctx context.Context, tx *sql.Tx, key interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWriteKey(key, nil)
+		if err != nil || !ok {
+			return 0, err
+		}
+		defer dao.invalidate(ctx, tx, key)
+		return dao.deleteByKey(ctx, tx, key)
+	}
+	defer s.invalidate(ctx, tx, key)
 	return s.deleteByKey(ctx, tx, key)
 }
 
 // 基于事务删除
 func (s SQLDao) TXDelete(ctx context.Context, tx *sql.Tx, where map[string]interface{}) (int64, error) {
+	if s.routing() {
+		dao, ok, err := s.routeWrite(where, nil)
+		if err != nil || !ok {
+			return 0, err
+		}
+		return dao.delete(ctx, tx, where)
+	}
 	return s.delete(ctx, tx, where)
 }
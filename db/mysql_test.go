@@ -0,0 +1,52 @@
+//go:build cgo
+// +build cgo
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// First、Find 将结果写入调用方传入的指针
+func TestSQLDao_scanTarget(t *testing.T) {
+	_, cleanup := openSQLite(t, "scan", mysqlconfig.Config{},
+		`CREATE TABLE t (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO t (id) VALUES (1), (2)`)
+	defer cleanup()
+
+	type row struct {
+		ID int64 `ddb:"id"`
+	}
+	dao := NewSQLDao("t", "scan", "id", nil)
+	ctx := context.Background()
+
+	var one row
+	if err := dao.First(ctx, map[string]interface{}{"_orderby": "id desc"}, &one); err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if one.ID != 2 {
+		t.Errorf("First() = %+v, want id 2", one)
+	}
+	var rows []row
+	if err := dao.Find(ctx, map[string]interface{}{"_orderby": "id"}, 0, 10, &rows); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != 1 || rows[1].ID != 2 {
+		t.Errorf("Find() = %+v, want ids [1 2]", rows)
+	}
+}
+
+func TestSQLDao_Insert(t *testing.T) {
+	_, cleanup := openSQLite(t, "insert", mysqlconfig.Config{},
+		`CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL)`,
+		`INSERT INTO sqlite_sequence (name, seq) VALUES ('t', 4)`)
+	defer cleanup()
+
+	id, err := NewSQLDao("t", "insert", "id", nil).Insert(context.Background(), map[string]interface{}{"name": "tom"})
+	if err != nil || id != 5 {
+		t.Errorf("Insert() = %d, %v, want 5", id, err)
+	}
+}
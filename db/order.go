@@ -0,0 +1,209 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 排序列及方向
+type orderKey struct {
+	column string
+	desc   bool
+}
+
+// 查询使用的排序, 条件中的 _orderby 优先于 SelectOrder
+func (s SQLDao) order(where map[string]interface{}) string {
+	if v, ok := where["_orderby"].(string); ok {
+		return v
+	}
+	return s.selectOrder
+}
+
+// 解析 "a desc, b" 形式的排序, 只支持列名
+func parseOrder(order string) ([]orderKey, error) {
+	var keys []orderKey
+	for _, part := range strings.Split(order, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("unsupported order %q", order)
+		}
+		key := orderKey{column: fields[0]}
+		if i := strings.LastIndex(key.column, "."); i >= 0 {
+			key.column = key.column[i+1:]
+		}
+		key.column = strings.Trim(key.column, "`\"")
+		if key.column == "" || strings.IndexFunc(key.column, notIdent) >= 0 {
+			return nil, fmt.Errorf("unsupported order %q", order)
+		}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				key.desc = true
+			default:
+				return nil, fmt.Errorf("unsupported order %q", order)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func notIdent(r rune) bool {
+	return !(r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// 按排序列对记录稳定排序, 记录需为结构体或其指针, 列按 ddb tag 或字段名匹配
+func sortRecords(records reflect.Value, keys []orderKey) error {
+	st := records.Type().Elem()
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return fmt.Errorf("records of %s cannot be sorted by column", st)
+	}
+	index := make([][]int, len(keys))
+	for i, key := range keys {
+		f, ok := orderField(st, key.column)
+		if !ok {
+			return fmt.Errorf("order column %s not found in %s", key.column, st)
+		}
+		index[i] = f.Index
+	}
+	var err error
+	sort.SliceStable(records.Interface(), func(i, j int) bool {
+		a, b := reflect.Indirect(records.Index(i)), reflect.Indirect(records.Index(j))
+		for k, key := range keys {
+			c, e := compareValue(a.FieldByIndex(index[k]), b.FieldByIndex(index[k]))
+			if e != nil {
+				err = e
+				return false
+			}
+			if c != 0 {
+				return (c < 0) != key.desc
+			}
+		}
+		return false
+	})
+	return err
+}
+
+func orderField(st reflect.Type, column string) (reflect.StructField, bool) {
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath == "" && strings.Split(f.Tag.Get("ddb"), ",")[0] == column {
+			return f, true
+		}
+	}
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath == "" && f.Tag.Get("ddb") == "" && strings.EqualFold(f.Name, column) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// 比较两个字段, nil 排在最前
+func compareValue(a, b reflect.Value) (int, error) {
+	x, err := sortValue(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := sortValue(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case x == nil && y == nil:
+		return 0, nil
+	case x == nil:
+		return -1, nil
+	case y == nil:
+		return 1, nil
+	}
+	switch x := x.(type) {
+	case int64:
+		if y, ok := y.(int64); ok {
+			return compareOrdered(x < y, x > y), nil
+		}
+	case uint64:
+		if y, ok := y.(uint64); ok {
+			return compareOrdered(x < y, x > y), nil
+		}
+	case float64:
+		if y, ok := y.(float64); ok {
+			return compareOrdered(x < y, x > y), nil
+		}
+	case string:
+		if y, ok := y.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case bool:
+		if y, ok := y.(bool); ok {
+			return compareOrdered(!x && y, x && !y), nil
+		}
+	case time.Time:
+		if y, ok := y.(time.Time); ok {
+			return compareOrdered(x.Before(y), x.After(y)), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", x, y)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// 转换为可比较的值, 支持基本类型、time.Time 及 driver.Valuer(如 sql.NullInt64)
+func sortValue(v reflect.Value) (interface{}, error) {
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		dv, err := valuer.Value()
+		if err != nil || dv == nil {
+			return nil, err
+		}
+		if b, ok := dv.([]byte); ok {
+			dv = string(b)
+		}
+		return dv, nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return sortValue(v.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot sort by %s", v.Type())
+}
@@ -0,0 +1,395 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// 分区周期
+type PartitionPeriod string
+
+const (
+	// 表名后缀 _20060102
+	PartitionDay PartitionPeriod = "day"
+	// 表名后缀 _200601, 默认
+	PartitionMonth PartitionPeriod = "month"
+	// 表名后缀 _2006
+	PartitionYear PartitionPeriod = "year"
+)
+
+var partitionLayouts = []string{"2006-01-02 15:04:05", "2006-01-02", time.RFC3339}
+
+// 按时间分表规则, 表名为 表名_时间
+type PartitionRule struct {
+	// 时间列名
+	Key    string
+	Period PartitionPeriod
+	// 计算表名后缀的时区, 默认 time.Local
+	Location *time.Location
+	// 保留的分区数, 查询未指定时间下界时从当前分区向前查询, 为 0 时查询已存在的所有分区
+	Retention int
+}
+
+func (r *PartitionRule) validate() error {
+	if r.Key == "" {
+		return errors.New("partition key is required")
+	}
+	switch r.Period {
+	case "", PartitionDay, PartitionMonth, PartitionYear:
+	default:
+		return fmt.Errorf("unknown partition period %q", r.Period)
+	}
+	if r.Retention < 0 {
+		return errors.New("partition retention must not be negative")
+	}
+	return nil
+}
+
+func (r *PartitionRule) location() *time.Location {
+	if r.Location == nil {
+		return time.Local
+	}
+	return r.Location
+}
+
+// 时间所在周期的开始时间
+func (r *PartitionRule) start(t time.Time) time.Time {
+	t = t.In(r.location())
+	switch r.Period {
+	case PartitionDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case PartitionYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// 向后移动 n 个周期
+func (r *PartitionRule) add(t time.Time, n int) time.Time {
+	switch r.Period {
+	case PartitionDay:
+		return t.AddDate(0, 0, n)
+	case PartitionYear:
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, n, 0)
+}
+
+// 表名后缀的时间格式
+func (r *PartitionRule) layout() string {
+	switch r.Period {
+	case PartitionDay:
+		return "20060102"
+	case PartitionYear:
+		return "2006"
+	}
+	return "200601"
+}
+
+func (r *PartitionRule) suffix(t time.Time) string {
+	return "_" + r.start(t).Format(r.layout())
+}
+
+// 分区键的值, 支持 time.Time 及常见格式的字符串
+func (r *PartitionRule) time(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range partitionLayouts {
+			if t, err := time.ParseInLocation(layout, v, r.location()); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return time.Time{}, fmt.Errorf("unsupported value type %T", value)
+}
+
+// 条件中分区键的时间范围, 支持 =、>、>=、<、<=、between 及 in, 未指定的边界为零值
+func (r *PartitionRule) bounds(where map[string]interface{}) (lo, hi time.Time, err error) {
+	narrow := func(from, to time.Time) {
+		if !from.IsZero() && (lo.IsZero() || from.After(lo)) {
+			lo = from
+		}
+		if !to.IsZero() && (hi.IsZero() || to.Before(hi)) {
+			hi = to
+		}
+	}
+	for key, val := range where {
+		field, op := splitWhereKey(key)
+		if field != r.Key {
+			continue
+		}
+		var vals []time.Time
+		switch op {
+		case "=", ">", ">=", "<", "<=":
+			t, err := r.time(val)
+			if err != nil {
+				return lo, hi, fmt.Errorf("partition key %s: %w", r.Key, err)
+			}
+			vals = []time.Time{t}
+		case "between", "in":
+			v := reflect.ValueOf(val)
+			if v.Kind() != reflect.Slice || v.Len() == 0 {
+				continue
+			}
+			for i := 0; i < v.Len(); i++ {
+				t, err := r.time(v.Index(i).Interface())
+				if err != nil {
+					return lo, hi, fmt.Errorf("partition key %s: %w", r.Key, err)
+				}
+				vals = append(vals, t)
+			}
+		default:
+			continue
+		}
+		min, max := vals[0], vals[0]
+		for _, t := range vals[1:] {
+			if t.Before(min) {
+				min = t
+			}
+			if t.After(max) {
+				max = t
+			}
+		}
+		switch op {
+		case ">", ">=":
+			narrow(min, time.Time{})
+		case "<":
+			narrow(time.Time{}, max.Add(-time.Nanosecond))
+		case "<=":
+			narrow(time.Time{}, max)
+		default:
+			narrow(min, max)
+		}
+	}
+	return lo, hi, nil
+}
+
+// 指定时间所在分区的 SQLDao
+func (s SQLDao) at(t time.Time) SQLDao {
+	s.tableName += s.partition.suffix(t)
+	s.partition = nil
+	return s
+}
+
+// 时间所在分区的 SQLDao, 用于事务或直接访问指定分区, 未分区时返回自身
+func (s SQLDao) Partition(t time.Time) *SQLDao {
+	if s.partition != nil {
+		s = s.at(t)
+	}
+	return &s
+}
+
+// 时间范围内的所有分区, 按时间升序
+func (s SQLDao) Partitions(from, to time.Time) []*SQLDao {
+	if s.partition == nil {
+		return []*SQLDao{&s}
+	}
+	daos := make([]*SQLDao, 0)
+	end := s.partition.start(to)
+	for t := s.partition.start(from); !t.After(end); t = s.partition.add(t, 1) {
+		dao := s.at(t)
+		daos = append(daos, &dao)
+	}
+	return daos
+}
+
+// 读操作对应的分区, 未指定上界时查询到当前分区, 未指定下界时按 Retention 回溯, Retention 为 0 时查询已存在的分区
+func (s SQLDao) partitionRoute(ctx context.Context, where map[string]interface{}) ([]SQLDao, error) {
+	lo, hi, err := s.partition.bounds(where)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if hi.IsZero() {
+		hi = now
+	}
+	if retention := s.partition.Retention; retention > 0 {
+		oldest := s.partition.add(s.partition.start(now), 1-retention)
+		if lo.Before(oldest) {
+			lo = oldest
+		}
+	} else if lo.IsZero() {
+		return s.existingPartitions(ctx, hi)
+	}
+	daos := make([]SQLDao, 0)
+	if hi.Before(lo) {
+		return daos, nil
+	}
+	for _, dao := range s.Partitions(lo, hi) {
+		daos = append(daos, *dao)
+	}
+	return daos, nil
+}
+
+// 连接上已存在且不晚于 hi 的分区, 按时间升序, hi 为零值时不限制
+func (s SQLDao) existingPartitions(ctx context.Context, hi time.Time) ([]SQLDao, error) {
+	handler, err := s.GetReadDbHandler(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var query string
+	switch s.dialect().name {
+	case mysqlconfig.DialectPostgres:
+		query = "SELECT tablename FROM pg_tables WHERE schemaname = current_schema() AND tablename LIKE $1"
+	case mysqlconfig.DialectSQLite:
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE ?"
+	default:
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name LIKE ?"
+	}
+	var starts []time.Time
+	err = s.query(ctx, handler, query, []interface{}{s.tableName + "_%"}, func(rows *sql.Rows) error {
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			if t, ok := s.partitionOf(name); ok && (hi.IsZero() || !t.After(hi)) {
+				starts = append(starts, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	daos := make([]SQLDao, len(starts))
+	for i, t := range starts {
+		daos[i] = s.at(t)
+	}
+	return daos, nil
+}
+
+// 表名对应分区的开始时间, 不是本表的分区时 ok 为 false
+func (s SQLDao) partitionOf(table string) (t time.Time, ok bool) {
+	if !strings.HasPrefix(table, s.tableName+"_") {
+		return t, false
+	}
+	t, err := time.ParseInLocation(s.partition.layout(), table[len(s.tableName)+1:], s.partition.location())
+	if err != nil {
+		return t, false
+	}
+	return t, true
+}
+
+// 写操作的条件需定位到单个分区, 修改分区键不能将记录移动到其他分区
+func (s SQLDao) partitionWrite(where map[string]interface{}, data map[string]interface{}) (SQLDao, bool, error) {
+	lo, hi, err := s.partition.bounds(where)
+	if err != nil {
+		return s, false, err
+	}
+	if lo.IsZero() && hi.IsZero() {
+		// 条件中没有时间时按数据中的时间定位, 如 UpdateByKey, 都没有时需通过 Partition(t) 指定分区
+		v, ok := data[s.partition.Key]
+		if !ok {
+			return s, false, fmt.Errorf("%w: table [%s] write without partition key %s, use Partition(t)", ErrCrossShard, s.tableName, s.partition.Key)
+		}
+		t, err := s.partition.time(v)
+		if err != nil {
+			return s, false, fmt.Errorf("partition key %s: %w", s.partition.Key, err)
+		}
+		return s.at(t), true, nil
+	}
+	if lo.IsZero() || hi.IsZero() {
+		return s, false, fmt.Errorf("%w: table [%s] condition without partition key %s range", ErrCrossShard, s.tableName, s.partition.Key)
+	}
+	if hi.Before(lo) {
+		return s, false, nil
+	}
+	suffix := s.partition.suffix(lo)
+	if s.partition.suffix(hi) != suffix {
+		return s, false, fmt.Errorf("%w: table [%s] condition spans partitions %s to %s", ErrCrossShard, s.tableName, suffix, s.partition.suffix(hi))
+	}
+	if v, ok := data[s.partition.Key]; ok {
+		t, err := s.partition.time(v)
+		if err != nil {
+			return s, false, fmt.Errorf("partition key %s: %w", s.partition.Key, err)
+		}
+		if s.partition.suffix(t) != suffix {
+			return s, false, fmt.Errorf("%w: table [%s] update moves record to partition %s", ErrCrossShard, s.tableName, s.partition.suffix(t))
+		}
+	}
+	return s.at(lo), true, nil
+}
+
+// 分区表不存在时按空结果处理, 用于跨分区查询
+func (s SQLDao) missingPartition(err error) bool {
+	if s.partition == nil || err == nil {
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1146
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no such table") || (strings.Contains(msg, "relation") && strings.Contains(msg, "does not exist"))
+}
+
+// 按模板表创建当前及之后 ahead 个周期的分区表, 已存在的表跳过, 分片时在每个分片上创建
+// template 为空时使用 SQLDao 的表名, 返回创建语句涉及的表名
+func (s SQLDao) CreatePartitions(ctx context.Context, template string, ahead int) ([]string, error) {
+	if s.partition == nil {
+		return nil, fmt.Errorf("table [%s] is not partitioned", s.tableName)
+	}
+	tables := make([]string, 0)
+	for _, shard := range s.Shards() {
+		handler, err := shard.GetDbHandler()
+		if err != nil {
+			return tables, err
+		}
+		tpl := template
+		if tpl == "" {
+			tpl = shard.tableName
+		}
+		now := shard.partition.start(time.Now())
+		for i := 0; i <= ahead; i++ {
+			target := shard.at(shard.partition.add(now, i))
+			stmt, err := target.createLike(ctx, handler, tpl)
+			if err != nil {
+				return tables, err
+			}
+			if _, err = target.exec(ctx, handler, stmt, nil); err != nil {
+				return tables, err
+			}
+			tables = append(tables, target.tableName)
+		}
+	}
+	return tables, nil
+}
+
+// 按模板表建表的语句, sqlite 复制模板的建表语句, 不包含索引
+func (s SQLDao) createLike(ctx context.Context, db dbExecutor, template string) (string, error) {
+	d := s.dialect()
+	switch d.name {
+	case mysqlconfig.DialectPostgres:
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)", d.Quote(s.tableName), d.Quote(template)), nil
+	case mysqlconfig.DialectSQLite:
+		var ddl string
+		err := db.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", template).Scan(&ddl)
+		if err != nil {
+			return "", fmt.Errorf("template table [%s]: %w", template, err)
+		}
+		i := strings.IndexByte(ddl, '(')
+		if i < 0 {
+			return "", fmt.Errorf("template table [%s] unexpected ddl %q", template, ddl)
+		}
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", d.Quote(s.tableName), ddl[i:]), nil
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", d.Quote(s.tableName), d.Quote(template)), nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLDao_partitionRoute(t *testing.T) {
+	dao := NewSQLDao("orders", "db", "id", &SQLDaoOption{Partition: &PartitionRule{Key: "created_at", Location: time.UTC}})
+	day := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02", s, time.UTC)
+		return t
+	}
+	tests := []struct {
+		name    string
+		where   map[string]interface{}
+		want    []string
+		wantErr bool
+	}{
+		{"eq", map[string]interface{}{"created_at": day("2026-10-18")}, []string{"orders_202610"}, false},
+		{"range", map[string]interface{}{"created_at >=": "2026-08-15", "created_at <": day("2026-10-01")}, []string{"orders_202608", "orders_202609"}, false},
+		{"between", map[string]interface{}{"created_at between": []time.Time{day("2025-12-31"), day("2026-01-01")}}, []string{"orders_202512", "orders_202601"}, false},
+		{"empty", map[string]interface{}{"created_at >": day("2026-10-01"), "created_at <": day("2026-09-01")}, []string{}, false},
+		{"invalid time", map[string]interface{}{"created_at": 1}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daos, err := dao.partitionRoute(context.Background(), tt.where)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("partitionRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make([]string, len(daos))
+			for i, d := range daos {
+				got[i] = d.tableName
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("partitionRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	retained := NewSQLDao("logs", "db", "id", &SQLDaoOption{Partition: &PartitionRule{Key: "ts", Period: PartitionDay, Retention: 3}})
+	if daos, err := retained.partitionRoute(context.Background(), nil); err != nil || len(daos) != 3 {
+		t.Errorf("partitionRoute() with retention = %d partitions, %v", len(daos), err)
+	}
+}
+
+func TestSQLDao_partitionWrite(t *testing.T) {
+	dao := NewSQLDao("orders", "db", "id", &SQLDaoOption{
+		Sharding:  &ShardRule{Key: "uid", Strategy: ShardModulo, Shards: []Shard{{Handle: "db0"}, {Handle: "db1"}}},
+		Partition: &PartitionRule{Key: "created_at", Period: PartitionYear, Location: time.UTC},
+	})
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	target, err := dao.routeInsert(map[string]interface{}{"uid": 3, "created_at": at})
+	if err != nil || target.handleName != "db1" || target.tableName != "orders_2026" {
+		t.Errorf("routeInsert() = %s.%s, %v", target.handleName, target.tableName, err)
+	}
+	if _, err := dao.routeInsert(map[string]interface{}{"uid": 3}); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeInsert() without partition key error = %v, want ErrCrossShard", err)
+	}
+
+	where := map[string]interface{}{"uid": 2, "created_at": at}
+	target, ok, err := dao.routeWrite(where, map[string]interface{}{"status": 1})
+	if err != nil || !ok || target.handleName != "db0" || target.tableName != "orders_2026" {
+		t.Errorf("routeWrite() = %s.%s %v, %v", target.handleName, target.tableName, ok, err)
+	}
+	if _, _, err := dao.routeWrite(where, map[string]interface{}{"created_at": at.AddDate(1, 0, 0)}); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWrite() moving record error = %v, want ErrCrossShard", err)
+	}
+	if _, _, err := dao.routeWrite(map[string]interface{}{"uid": 2, "created_at >": at}, nil); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWrite() without upper bound error = %v, want ErrCrossShard", err)
+	}
+	if _, _, err := dao.routeWriteKey(1, nil); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWriteKey() error = %v, want ErrCrossShard", err)
+	}
+
+	// 按主键写入时按数据中的时间定位分区
+	dao = NewSQLDao("orders", "db", "id", &SQLDaoOption{
+		Partition: &PartitionRule{Key: "created_at", Period: PartitionYear, Location: time.UTC},
+	})
+	target, ok, err = dao.routeWriteKey(1, map[string]interface{}{"status": 1, "created_at": at})
+	if err != nil || !ok || target.tableName != "orders_2026" {
+		t.Errorf("routeWriteKey() = %s %v, %v, want orders_2026", target.tableName, ok, err)
+	}
+	if _, _, err := dao.routeWriteKey(1, map[string]interface{}{"status": 1}); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWriteKey() without time error = %v, want ErrCrossShard", err)
+	}
+	if _, _, err := dao.routeWriteKey(1, nil); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWriteKey() delete error = %v, want ErrCrossShard", err)
+	}
+	// 指定分区后不再路由
+	if p := dao.Partition(at); p.routing() || p.tableName != "orders_2026" {
+		t.Errorf("Partition() = %s routing %v, want orders_2026", p.tableName, p.routing())
+	}
+}
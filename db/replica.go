@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+type primaryCtxKey struct{}
+
+// 强制读主库, 用于写后立即读取的场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return v
+}
+
+// get mysql read databases handler, replicas first
+func (s SQLDao) GetReadDbHandler(ctx context.Context) (db *sql.DB, err error) {
+	if usePrimary(ctx) {
+		return s.GetDbHandler()
+	}
+	return mysqlconfig.GetReplica(s.handleName)
+}
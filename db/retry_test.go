@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+)
+
+var fake = &fakesql.Driver{}
+
+func init() {
+	sql.Register("toolkit-db-fake", fake)
+	mysqlconfig.RegisterDriver("toolkit-db-fake", mysqlconfig.DialectMySQL, "", func(c mysqlconfig.Config) string {
+		return c.Host
+	})
+}
+
+// 连接断开时按 bad_conn 重试只读查询, database/sql 自身重试 3 次后才返回 ErrBadConn
+func TestSQLDao_queryRetriesBadConn(t *testing.T) {
+	tests := []struct {
+		name    string
+		badConn bool
+		wantErr error
+	}{
+		{"enabled", true, nil},
+		{"disabled", false, driver.ErrBadConn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mysqlconfig.Configs{"badconn": mysqlconfig.Config{
+				Driver:      "toolkit-db-fake",
+				Host:        "badconn",
+				RetryPolicy: mysqlconfig.RetryPolicy{MaxAttempts: 2, BadConn: tt.badConn},
+			}}
+			if err := c.Init(); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			defer c.Close()
+			defer fake.Reset()
+
+			var mu sync.Mutex
+			failures := 0
+			fake.Handle(func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+				if !strings.HasPrefix(query, "SELECT") {
+					return nil, nil
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if failures < 3 {
+					failures++
+					return nil, driver.ErrBadConn
+				}
+				return &fakesql.Result{Columns: []string{"id"}, Rows: [][]driver.Value{{int64(1)}}}, nil
+			})
+
+			type row struct {
+				ID int64 `ddb:"id"`
+			}
+			var rows []row
+			err := NewSQLDao("t", "badconn", "id", nil).Find(context.Background(), nil, 0, 10, &rows)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Find() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (len(rows) != 1 || rows[0].ID != 1) {
+				t.Errorf("Find() = %+v, want id 1", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type mysqlInspector struct{}
+
+func (mysqlInspector) tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME, TABLE_COMMENT FROM information_schema.TABLES "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := make([]Table, 0)
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Name, &t.Comment); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (mysqlInspector) columns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, EXTRA, COLUMN_COMMENT "+
+		"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make([]Column, 0)
+	for rows.Next() {
+		var c Column
+		var nullable, key, extra string
+		if err := rows.Scan(&c.Name, &c.DataType, &c.ColumnType, &nullable, &key, &extra, &c.Comment); err != nil {
+			return nil, err
+		}
+		c.DataType = strings.ToLower(c.DataType)
+		c.ColumnType = strings.ToLower(c.ColumnType)
+		c.Nullable = nullable == "YES"
+		c.Primary = key == "PRI"
+		c.AutoIncrement = strings.Contains(strings.ToLower(extra), "auto_increment")
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+type postgresInspector struct{}
+
+func (postgresInspector) tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT t.table_name, COALESCE(obj_description(c.oid, 'pg_class'), '') "+
+		"FROM information_schema.tables t JOIN pg_class c ON c.relname = t.table_name "+
+		"JOIN pg_namespace n ON n.oid = c.relnamespace AND n.nspname = t.table_schema "+
+		"WHERE t.table_schema = current_schema() AND t.table_type = 'BASE TABLE' ORDER BY t.table_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := make([]Table, 0)
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Name, &t.Comment); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (postgresInspector) columns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.QueryContext(ctx, "SELECT c.column_name, c.data_type, c.udt_name, c.is_nullable, "+
+		"COALESCE(c.column_default, ''), c.is_identity, "+
+		"EXISTS (SELECT 1 FROM information_schema.table_constraints tc "+
+		"JOIN information_schema.key_column_usage k ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema "+
+		"WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema AND tc.table_name = c.table_name AND k.column_name = c.column_name) "+
+		"FROM information_schema.columns c WHERE c.table_schema = current_schema() AND c.table_name = $1 ORDER BY c.ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make([]Column, 0)
+	for rows.Next() {
+		var c Column
+		var nullable, def, identity string
+		if err := rows.Scan(&c.Name, &c.DataType, &c.ColumnType, &nullable, &def, &identity, &c.Primary); err != nil {
+			return nil, err
+		}
+		c.DataType = strings.ToLower(c.DataType)
+		c.Nullable = nullable == "YES"
+		c.AutoIncrement = identity == "YES" || strings.HasPrefix(def, "nextval(")
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+type sqliteInspector struct{}
+
+func (sqliteInspector) tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := make([]Table, 0)
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (sqliteInspector) columns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make([]Column, 0)
+	for rows.Next() {
+		var c Column
+		var notNull, pk int
+		if err := rows.Scan(&c.Name, &c.ColumnType, &notNull, &pk); err != nil {
+			return nil, err
+		}
+		c.ColumnType = strings.ToLower(c.ColumnType)
+		c.DataType = c.ColumnType
+		if i := strings.IndexByte(c.DataType, '('); i >= 0 {
+			c.DataType = strings.TrimSpace(c.DataType[:i])
+		}
+		c.Nullable = notNull == 0 && pk == 0
+		c.Primary = pk > 0
+		// INTEGER PRIMARY KEY 为 rowid 别名
+		c.AutoIncrement = c.Primary && c.DataType == "integer"
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
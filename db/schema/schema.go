@@ -0,0 +1,106 @@
+// 读取连接对应数据库的表结构, 用于代码生成及结构体校验
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+type Column struct {
+	Name string
+	// 数据类型, 如 varchar、bigint
+	DataType string
+	// 完整类型, 如 varchar(64)、bigint(20) unsigned
+	ColumnType    string
+	Nullable      bool
+	Primary       bool
+	AutoIncrement bool
+	Comment       string
+}
+
+type Table struct {
+	Name    string
+	Comment string
+	Columns []Column
+}
+
+// 主键字段, 按字段顺序
+func (t *Table) PrimaryKey() []string {
+	pk := make([]string, 0, 1)
+	for _, c := range t.Columns {
+		if c.Primary {
+			pk = append(pk, c.Name)
+		}
+	}
+	return pk
+}
+
+func (t *Table) Column(name string) (Column, bool) {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+type inspector interface {
+	tables(ctx context.Context, db *sql.DB) ([]Table, error)
+	columns(ctx context.Context, db *sql.DB, table string) ([]Column, error)
+}
+
+var inspectors = map[string]inspector{
+	mysqlconfig.DialectMySQL:    mysqlInspector{},
+	mysqlconfig.DialectPostgres: postgresInspector{},
+	mysqlconfig.DialectSQLite:   sqliteInspector{},
+}
+
+func getInspector(dbHandler string) (*sql.DB, inspector, error) {
+	dialect := mysqlconfig.Dialect(dbHandler)
+	in, ok := inspectors[dialect]
+	if !ok {
+		return nil, nil, fmt.Errorf("schema: dialect [%s] not supported", dialect)
+	}
+	db, err := mysqlconfig.Get(dbHandler)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, in, nil
+}
+
+// 当前库的所有表, 不含字段
+func Tables(ctx context.Context, dbHandler string) ([]Table, error) {
+	db, in, err := getInspector(dbHandler)
+	if err != nil {
+		return nil, err
+	}
+	return in.tables(ctx, db)
+}
+
+// 表结构, 表不存在时返回错误
+func Describe(ctx context.Context, dbHandler string, table string) (*Table, error) {
+	db, in, err := getInspector(dbHandler)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := in.columns(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("schema: table [%s] not found in db [%s]", table, dbHandler)
+	}
+	t := &Table{Name: table, Columns: columns}
+	if tables, err := in.tables(ctx, db); err == nil {
+		for _, item := range tables {
+			if item.Name == table {
+				t.Comment = item.Comment
+			}
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,55 @@
+package schema
+
+import "strings"
+
+// 字段对应的 go 类型, 可为 NULL 的字段使用 sql.Null* 类型
+func (c Column) GoType() string {
+	t := c.baseType()
+	if !c.Nullable {
+		return t
+	}
+	switch t {
+	case "bool":
+		return "sql.NullBool"
+	case "int64", "uint64":
+		return "sql.NullInt64"
+	case "float64":
+		return "sql.NullFloat64"
+	case "time.Time":
+		return "sql.NullTime"
+	case "string":
+		return "sql.NullString"
+	}
+	return t
+}
+
+func (c Column) baseType() string {
+	switch c.DataType {
+	case "tinyint":
+		if strings.HasPrefix(c.ColumnType, "tinyint(1)") {
+			return "bool"
+		}
+		return c.intType()
+	case "bool", "boolean":
+		return "bool"
+	case "smallint", "mediumint", "int", "integer", "bigint",
+		"int2", "int4", "int8", "serial", "bigserial", "smallserial":
+		return c.intType()
+	case "float", "double", "real", "double precision", "float4", "float8":
+		return "float64"
+	case "date", "datetime", "timestamp", "timestamptz",
+		"timestamp with time zone", "timestamp without time zone":
+		return "time.Time"
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob", "bytea", "bit":
+		return "[]byte"
+	}
+	// decimal 等按字符串处理避免精度丢失
+	return "string"
+}
+
+func (c Column) intType() string {
+	if c.DataType == "bigint" && strings.Contains(c.ColumnType, "unsigned") {
+		return "uint64"
+	}
+	return "int64"
+}
@@ -0,0 +1,454 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/didi/gendry/scanner"
+)
+
+// 写操作无法定位到单个分片, 如条件中缺少分片键或分片键跨多个分片
+var ErrCrossShard = errors.New("cross-shard write")
+
+// 分片策略
+type ShardStrategy string
+
+const (
+	// 分片键对分片数取模, 分片键需为整数
+	ShardModulo ShardStrategy = "modulo"
+	// 按 Ranges 划分的区间, 分片键需为整数
+	ShardRange ShardStrategy = "range"
+	// 分片键的 fnv 哈希对分片数取模, 支持任意类型
+	ShardHash ShardStrategy = "hash"
+)
+
+// 分片位置, Handle 为空时使用 SQLDao 的连接
+type Shard struct {
+	Handle string
+	// 表名后缀, 如 _00
+	Suffix string
+}
+
+// 分片规则
+type ShardRule struct {
+	// 分片键列名
+	Key      string
+	Strategy ShardStrategy
+	Shards   []Shard
+	// range 策略各分片的上界(不含), 递增且与 Shards 一一对应
+	Ranges []int64
+}
+
+func (r *ShardRule) validate() error {
+	if r.Key == "" || len(r.Shards) == 0 {
+		return errors.New("shard key and shards are required")
+	}
+	switch r.Strategy {
+	case ShardModulo, ShardHash:
+	case ShardRange:
+		if len(r.Ranges) != len(r.Shards) {
+			return fmt.Errorf("range strategy needs %d ranges, got %d", len(r.Shards), len(r.Ranges))
+		}
+		for i := 1; i < len(r.Ranges); i++ {
+			if r.Ranges[i] <= r.Ranges[i-1] {
+				return errors.New("shard ranges must be increasing")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown shard strategy %q", r.Strategy)
+	}
+	return nil
+}
+
+// 分片键对应的分片序号
+func (r *ShardRule) locate(value interface{}) (int, error) {
+	n := len(r.Shards)
+	if r.Strategy == ShardHash {
+		h := fnv.New32a()
+		fmt.Fprint(h, value)
+		return int(h.Sum32() % uint32(n)), nil
+	}
+	v, err := shardInt(value)
+	if err != nil {
+		return 0, fmt.Errorf("shard key %s: %w", r.Key, err)
+	}
+	if r.Strategy == ShardModulo {
+		i := v % int64(n)
+		if i < 0 {
+			i += int64(n)
+		}
+		return int(i), nil
+	}
+	i := sort.Search(n, func(i int) bool { return v < r.Ranges[i] })
+	if i == n {
+		return 0, fmt.Errorf("shard key %s value %d out of range", r.Key, v)
+	}
+	return i, nil
+}
+
+func shardInt(value interface{}) (int64, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.String:
+		return strconv.ParseInt(v.String(), 10, 64)
+	}
+	return 0, fmt.Errorf("unsupported value type %T", value)
+}
+
+// 指定分片上的 SQLDao
+func (s SQLDao) on(i int) SQLDao {
+	shard := s.sharding.Shards[i]
+	if shard.Handle != "" {
+		s.handleName = shard.Handle
+	}
+	s.tableName += shard.Suffix
+	s.sharding = nil
+	return s
+}
+
+// 分片键所在分片的 SQLDao, 用于在分片连接上开启事务, 分区表仍按时间路由
+func (s SQLDao) Shard(value interface{}) (*SQLDao, error) {
+	if s.sharding == nil {
+		return &s, nil
+	}
+	i, err := s.sharding.locate(value)
+	if err != nil {
+		return nil, err
+	}
+	dao := s.on(i)
+	return &dao, nil
+}
+
+// 所有分片的 SQLDao, 未分片时返回自身
+func (s SQLDao) Shards() []*SQLDao {
+	if s.sharding == nil {
+		return []*SQLDao{&s}
+	}
+	daos := make([]*SQLDao, len(s.sharding.Shards))
+	for i := range daos {
+		dao := s.on(i)
+		daos[i] = &dao
+	}
+	return daos
+}
+
+func (s SQLDao) all() []SQLDao {
+	daos := make([]SQLDao, len(s.sharding.Shards))
+	for i := range daos {
+		daos[i] = s.on(i)
+	}
+	return daos
+}
+
+// 是否需要按分片或分区路由
+func (s SQLDao) routing() bool {
+	return s.sharding != nil || s.partition != nil
+}
+
+// 读操作对应的分片及分区, 未指定分片键时 routed 为 false
+func (s SQLDao) route(ctx context.Context, where map[string]interface{}) (daos []SQLDao, routed bool, err error) {
+	daos, routed = []SQLDao{s}, true
+	if s.sharding != nil {
+		if daos, routed, err = s.shardRoute(where); err != nil {
+			return nil, false, err
+		}
+	}
+	if s.partition == nil {
+		return daos, routed, nil
+	}
+	parts := make([]SQLDao, 0, len(daos))
+	for _, dao := range daos {
+		p, err := dao.partitionRoute(ctx, where)
+		if err != nil {
+			return nil, false, err
+		}
+		parts = append(parts, p...)
+	}
+	return parts, routed, nil
+}
+
+// 条件中分片键对应的分片, 支持 key、"key =" 及 "key in", 未指定分片键时 routed 为 false
+func (s SQLDao) shardRoute(where map[string]interface{}) (daos []SQLDao, routed bool, err error) {
+	var matched map[int]bool
+	for key, val := range where {
+		field, op := splitWhereKey(key)
+		if field != s.sharding.Key {
+			continue
+		}
+		var vals []interface{}
+		switch op {
+		case "=":
+			vals = []interface{}{val}
+		case "in":
+			v := reflect.ValueOf(val)
+			if v.Kind() != reflect.Slice {
+				continue
+			}
+			for i := 0; i < v.Len(); i++ {
+				vals = append(vals, v.Index(i).Interface())
+			}
+		default:
+			continue
+		}
+		set := map[int]bool{}
+		for _, v := range vals {
+			i, err := s.sharding.locate(v)
+			if err != nil {
+				return nil, false, err
+			}
+			if matched == nil || matched[i] {
+				set[i] = true
+			}
+		}
+		matched = set
+	}
+	if matched == nil {
+		return s.all(), false, nil
+	}
+	for i := range s.sharding.Shards {
+		if matched[i] {
+			daos = append(daos, s.on(i))
+		}
+	}
+	return daos, true, nil
+}
+
+// 拆分 gendry 条件的列名及操作符, 如 "uid in"
+func splitWhereKey(key string) (field string, op string) {
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	op = strings.ToLower(strings.Join(fields[1:], " "))
+	if op == "" {
+		op = "="
+	}
+	return strings.Trim(fields[0], "`"), op
+}
+
+// 写操作定位单个分片及分区, 无法定位时返回 ErrCrossShard, 条件不匹配任何分片时 ok 为 false
+func (s SQLDao) routeWrite(where map[string]interface{}, data map[string]interface{}) (dao SQLDao, ok bool, err error) {
+	dao = s
+	if s.sharding != nil {
+		daos, routed, err := s.shardRoute(where)
+		if err != nil {
+			return dao, false, err
+		}
+		if !routed {
+			return dao, false, fmt.Errorf("%w: table [%s] condition without shard key %s", ErrCrossShard, s.tableName, s.sharding.Key)
+		}
+		if len(daos) > 1 {
+			return dao, false, fmt.Errorf("%w: table [%s] condition spans %d shards", ErrCrossShard, s.tableName, len(daos))
+		}
+		if len(daos) == 0 {
+			return dao, false, nil
+		}
+		// 修改分片键不能将记录移动到其他分片
+		if v, ok := data[s.sharding.Key]; ok {
+			target, err := s.Shard(v)
+			if err != nil {
+				return dao, false, err
+			}
+			if target.handleName != daos[0].handleName || target.tableName != daos[0].tableName {
+				return dao, false, fmt.Errorf("%w: table [%s] update moves record to %s", ErrCrossShard, s.tableName, target.tableName)
+			}
+		}
+		dao = daos[0]
+	}
+	if dao.partition != nil {
+		return dao.partitionWrite(where, data)
+	}
+	return dao, true, nil
+}
+
+func (s SQLDao) routeWriteKey(key interface{}, data map[string]interface{}) (SQLDao, bool, error) {
+	if s.sharding != nil && s.pk != s.sharding.Key {
+		return SQLDao{}, false, fmt.Errorf("%w: table [%s] pk %s is not shard key %s", ErrCrossShard, s.tableName, s.pk, s.sharding.Key)
+	}
+	return s.routeWrite(s.pkCond(key), data)
+}
+
+// 新增记录按数据中的分片键及分区时间定位
+func (s SQLDao) routeInsert(data map[string]interface{}) (SQLDao, error) {
+	dao := s
+	if s.sharding != nil {
+		v, ok := data[s.sharding.Key]
+		if !ok {
+			return SQLDao{}, fmt.Errorf("%w: table [%s] insert without shard key %s", ErrCrossShard, s.tableName, s.sharding.Key)
+		}
+		d, err := s.Shard(v)
+		if err != nil {
+			return SQLDao{}, err
+		}
+		dao = *d
+	}
+	if dao.partition != nil {
+		v, ok := data[dao.partition.Key]
+		if !ok {
+			return SQLDao{}, fmt.Errorf("%w: table [%s] insert without partition key %s", ErrCrossShard, s.tableName, dao.partition.Key)
+		}
+		t, err := dao.partition.time(v)
+		if err != nil {
+			return SQLDao{}, fmt.Errorf("partition key %s: %w", dao.partition.Key, err)
+		}
+		dao = dao.at(t)
+	}
+	return dao, nil
+}
+
+func copyWhere(where map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(where))
+	for k, v := range where {
+		m[k] = v
+	}
+	return m
+}
+
+// 并发在各分片执行, 按分片顺序返回第一个错误
+func scatter(daos []SQLDao, fn func(i int, dao SQLDao) error) error {
+	errs := make([]error, len(daos))
+	var wg sync.WaitGroup
+	for i, dao := range daos {
+		wg.Add(1)
+		go func(i int, dao SQLDao) {
+			defer wg.Done()
+			errs[i] = fn(i, dao)
+		}(i, dao)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按唯一键查询, 依次查询各分片, 返回第一条匹配的记录
+func (s SQLDao) shardLookup(ctx context.Context, daos []SQLDao, where map[string]interface{}, record interface{}) error {
+	for _, dao := range daos {
+		handler, err := dao.GetReadDbHandler(ctx)
+		if err != nil {
+			return err
+		}
+		err = dao.first(ctx, handler, copyWhere(where), record)
+		if err != scanner.ErrEmptyResult && !s.missingPartition(err) {
+			return err
+		}
+	}
+	return scanner.ErrEmptyResult
+}
+
+// 各分片查询第一条, 按排序列(条件中的 _orderby 或 SelectOrder)取最前的记录, 跨多个分片时必须指定排序
+func (s SQLDao) shardFirst(ctx context.Context, daos []SQLDao, where map[string]interface{}, record interface{}) error {
+	if len(daos) <= 1 {
+		return s.shardLookup(ctx, daos, where, record)
+	}
+	if s.order(where) == "" {
+		return fmt.Errorf("table [%s] first across %d shards without _orderby or SelectOrder", s.tableName, len(daos))
+	}
+	rv := reflect.ValueOf(record)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("record must be a non-nil pointer")
+	}
+	records := reflect.New(reflect.SliceOf(rv.Elem().Type()))
+	if err := s.shardFind(ctx, daos, where, 0, 1, records.Interface()); err != nil {
+		return err
+	}
+	if records.Elem().Len() == 0 {
+		return scanner.ErrEmptyResult
+	}
+	rv.Elem().Set(records.Elem().Index(0))
+	return nil
+}
+
+// 各分片查询前 offset+limit 条, 合并后按排序列(条件中的 _orderby 或 SelectOrder)排序再分页, 未指定排序时按分片顺序合并
+func (s SQLDao) shardFind(ctx context.Context, daos []SQLDao, where map[string]interface{}, offset uint, limit uint, records interface{}) error {
+	rv := reflect.ValueOf(records)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("records must be a pointer to slice")
+	}
+	if len(daos) == 1 {
+		handler, err := daos[0].GetReadDbHandler(ctx)
+		if err != nil {
+			return err
+		}
+		if err = daos[0].find(ctx, handler, where, offset, limit, records); s.missingPartition(err) {
+			return nil
+		}
+		return err
+	}
+	var keys []orderKey
+	if order := s.order(where); order != "" {
+		var err error
+		if keys, err = parseOrder(order); err != nil {
+			return err
+		}
+	}
+	if limit == 0 {
+		limit = uint(s.pageSize)
+	}
+	each := uint(0)
+	if limit > 0 {
+		each = offset + limit
+	}
+	parts := make([]reflect.Value, len(daos))
+	err := scatter(daos, func(i int, dao SQLDao) error {
+		handler, err := dao.GetReadDbHandler(ctx)
+		if err != nil {
+			return err
+		}
+		parts[i] = reflect.New(rv.Elem().Type())
+		if err = dao.find(ctx, handler, copyWhere(where), 0, each, parts[i].Interface()); s.missingPartition(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	merged := reflect.MakeSlice(rv.Elem().Type(), 0, 0)
+	for _, part := range parts {
+		merged = reflect.AppendSlice(merged, part.Elem())
+	}
+	if len(keys) > 0 {
+		if err := sortRecords(merged, keys); err != nil {
+			return fmt.Errorf("table [%s] merge shards: %w", s.tableName, err)
+		}
+	}
+	lo, hi := int(offset), merged.Len()
+	if lo > hi {
+		lo = hi
+	}
+	if limit > 0 && lo+int(limit) < hi {
+		hi = lo + int(limit)
+	}
+	rv.Elem().Set(merged.Slice(lo, hi))
+	return nil
+}
+
+func (s SQLDao) shardCount(ctx context.Context, daos []SQLDao, where map[string]interface{}) (int64, error) {
+	counts := make([]int64, len(daos))
+	err := scatter(daos, func(i int, dao SQLDao) (err error) {
+		if counts[i], err = dao.Count(ctx, copyWhere(where)); s.missingPartition(err) {
+			return nil
+		}
+		return err
+	})
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, err
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShardRule_locate(t *testing.T) {
+	shards := []Shard{{Handle: "db0", Suffix: "_0"}, {Handle: "db1", Suffix: "_1"}, {Handle: "db2", Suffix: "_2"}}
+	tests := []struct {
+		name    string
+		rule    ShardRule
+		value   interface{}
+		want    int
+		wantErr bool
+	}{
+		{"modulo", ShardRule{Key: "uid", Strategy: ShardModulo, Shards: shards}, int64(7), 1, false},
+		{"modulo string", ShardRule{Key: "uid", Strategy: ShardModulo, Shards: shards}, "8", 2, false},
+		{"modulo negative", ShardRule{Key: "uid", Strategy: ShardModulo, Shards: shards}, -1, 2, false},
+		{"modulo float", ShardRule{Key: "uid", Strategy: ShardModulo, Shards: shards}, 1.5, 0, true},
+		{"range", ShardRule{Key: "uid", Strategy: ShardRange, Shards: shards, Ranges: []int64{100, 200, 300}}, uint(100), 1, false},
+		{"range out", ShardRule{Key: "uid", Strategy: ShardRange, Shards: shards, Ranges: []int64{100, 200, 300}}, 300, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			got, err := tt.rule.locate(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("locate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("locate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	hash := ShardRule{Key: "email", Strategy: ShardHash, Shards: shards}
+	a, _ := hash.locate("a@example.com")
+	b, _ := hash.locate("a@example.com")
+	if a != b {
+		t.Errorf("hash locate() not stable: %d != %d", a, b)
+	}
+	if err := (&ShardRule{Key: "uid", Strategy: ShardRange, Shards: shards, Ranges: []int64{1, 1, 2}}).validate(); err == nil {
+		t.Error("validate() accepted non-increasing ranges")
+	}
+}
+
+func TestSQLDao_route(t *testing.T) {
+	dao := NewSQLDao("orders", "db", "uid", &SQLDaoOption{Sharding: &ShardRule{
+		Key:      "uid",
+		Strategy: ShardModulo,
+		Shards:   []Shard{{Handle: "db0", Suffix: "_0"}, {Handle: "db1", Suffix: "_1"}},
+	}})
+	tables := func(daos []SQLDao) []string {
+		names := make([]string, len(daos))
+		for i, d := range daos {
+			names[i] = d.handleName + "." + d.tableName
+		}
+		return names
+	}
+
+	tests := []struct {
+		name   string
+		where  map[string]interface{}
+		want   []string
+		routed bool
+	}{
+		{"eq", map[string]interface{}{"uid": 3}, []string{"db1.orders_1"}, true},
+		{"eq op", map[string]interface{}{"uid =": 4, "status": 1}, []string{"db0.orders_0"}, true},
+		{"in", map[string]interface{}{"uid in": []int{1, 2}}, []string{"db0.orders_0", "db1.orders_1"}, true},
+		{"intersect", map[string]interface{}{"uid in": []int{1, 2}, "uid": 2}, []string{"db0.orders_0"}, true},
+		{"scatter", map[string]interface{}{"uid >": 1}, []string{"db0.orders_0", "db1.orders_1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daos, routed, err := dao.route(context.Background(), tt.where)
+			if err != nil {
+				t.Fatalf("route() error = %v", err)
+			}
+			if got := tables(daos); routed != tt.routed || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("route() = %v %v, want %v %v", got, routed, tt.want, tt.routed)
+			}
+		})
+	}
+
+	if _, _, err := dao.routeWrite(map[string]interface{}{"status": 1}, nil); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWrite() without shard key error = %v, want ErrCrossShard", err)
+	}
+	if _, _, err := dao.routeWrite(map[string]interface{}{"uid in": []int{1, 2}}, nil); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWrite() across shards error = %v, want ErrCrossShard", err)
+	}
+	if _, _, err := dao.routeWriteKey(1, map[string]interface{}{"uid": 2}); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeWriteKey() moving record error = %v, want ErrCrossShard", err)
+	}
+	if _, err := dao.routeInsert(map[string]interface{}{"amount": 1}); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("routeInsert() without shard key error = %v, want ErrCrossShard", err)
+	}
+	if shard, err := dao.Shard(5); err != nil || shard.handleName != "db1" || shard.tableName != "orders_1" {
+		t.Errorf("Shard() = %+v, %v", shard, err)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		order   string
+		want    []orderKey
+		wantErr bool
+	}{
+		{"id", []orderKey{{column: "id"}}, false},
+		{"age DESC, `u`.`id` asc", []orderKey{{column: "age", desc: true}, {column: "id"}}, false},
+		{"field(id, 1, 2)", nil, true},
+		{"age down", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			got, err := parseOrder(tt.order)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOrder() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// sql 日志格式化: 指纹及参数脱敏
+package sqlfmt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	inList     = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	valuesList = regexp.MustCompile(`\(\?\+\)(?:\s*,\s*\(\?\+\))+`)
+)
+
+// 生成 sql 指纹, 字面量及占位符替换为 ?, 合并 IN 列表及批量 VALUES, 压缩空白并转为小写
+func Fingerprint(query string) string {
+	var buf strings.Builder
+	buf.Grow(len(query))
+	space := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			space = buf.Len() > 0
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		switch {
+		case ch == '\'':
+			// 字符串字面量
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			buf.WriteByte('?')
+		case ch == '`' || ch == '"':
+			// 标识符原样保留
+			j := strings.IndexByte(query[i+1:], ch)
+			if j < 0 {
+				buf.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			buf.WriteString(query[i : i+j+2])
+			i += j + 1
+		case ch == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			buf.WriteByte('?')
+		case isDigit(ch) && (i == 0 || !isIdent(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			buf.WriteByte('?')
+		case ch >= 'A' && ch <= 'Z':
+			buf.WriteByte(ch + 'a' - 'A')
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	fp := inList.ReplaceAllString(buf.String(), "(?+)")
+	return valuesList.ReplaceAllString(fp, "(?+)")
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdent(ch byte) bool {
+	return isDigit(ch) || ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// 参数脱敏, 字符串及二进制仅保留长度
+func MaskArgs(args []interface{}) []string {
+	masked := make([]string, 0, len(args))
+	for _, arg := range args {
+		masked = append(masked, maskArg(arg))
+	}
+	return masked
+}
+
+func maskArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("'***'(%d)", utf8.RuneCountInString(v))
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(v))
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case fmt.Stringer:
+		return "'***'"
+	default:
+		return fmt.Sprintf("<%T>", arg)
+	}
+}
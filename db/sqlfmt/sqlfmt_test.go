@@ -0,0 +1,31 @@
+package sqlfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE (id=? AND name IN (?,?,?)) LIMIT ?,?", "select * from users where (id=? and name in (?+)) limit ?,?"},
+		{"INSERT INTO users (a,b) VALUES (?,?),(?,?)", "insert into users (a,b) values (?+)"},
+		{"select  *\n from t1 where a = 'x''y' and b=12.5 and `Col2`=3", "select * from t1 where a = ? and b=? and `Col2`=?"},
+		{`SELECT * FROM "Users" WHERE id=$1 LIMIT $2 OFFSET $3`, `select * from "Users" where id=? limit ? offset ?`},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMaskArgs(t *testing.T) {
+	got := MaskArgs([]interface{}{1, "secret", []byte("abc"), nil, true})
+	want := []string{"1", "'***'(6)", "<3 bytes>", "NULL", "true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MaskArgs() = %v, want %v", got, want)
+	}
+}
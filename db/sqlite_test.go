@@ -0,0 +1,386 @@
+//go:build cgo
+// +build cgo
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/didi/gendry/scanner"
+	"github.com/mattn/go-sqlite3"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+)
+
+var (
+	onRowMu sync.Mutex
+	onRow   func()
+)
+
+// 设置 on_row() 的回调, 视图中引用 on_row() 时读取每行结果都会调用
+func setOnRow(fn func()) {
+	onRowMu.Lock()
+	defer onRowMu.Unlock()
+	onRow = fn
+}
+
+func callOnRow() int64 {
+	onRowMu.Lock()
+	fn := onRow
+	onRowMu.Unlock()
+	if fn != nil {
+		fn()
+	}
+	return 0
+}
+
+func init() {
+	sql.Register("toolkit-db-sqlite", &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		return conn.RegisterFunc("on_row", callOnRow, false)
+	}})
+	mysqlconfig.RegisterDriver("toolkit-db-sqlite", mysqlconfig.DialectSQLite, "", func(c mysqlconfig.Config) string {
+		return c.DB
+	})
+}
+
+// 在临时目录创建 sqlite 数据库并注册为 name 连接, 执行 schema 中的语句, 返回清理方法
+func openSQLite(t *testing.T, name string, c mysqlconfig.Config, schema ...string) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Driver, c.DB = "toolkit-db-sqlite", filepath.Join(dir, "test.db")
+	configs := mysqlconfig.Configs{name: c}
+	if err := configs.Init(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Init() error = %v", err)
+	}
+	cleanup := func() {
+		configs.Close()
+		os.RemoveAll(dir)
+	}
+	db, err := mysqlconfig.Get(name)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			cleanup()
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db, cleanup
+}
+
+type sqliteUser struct {
+	ID   int64  `ddb:"id"`
+	Name string `ddb:"name"`
+	Age  int    `ddb:"age"`
+}
+
+const usersTable = `CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, age INTEGER NOT NULL)`
+
+func TestSQLDao_sqliteCRUD(t *testing.T) {
+	db, cleanup := openSQLite(t, "lite", mysqlconfig.Config{}, usersTable)
+	defer cleanup()
+	dao := NewSQLDao("users", "lite", "id", nil)
+	ctx := context.Background()
+
+	for i, name := range []string{"tom", "jerry", "spike"} {
+		id, err := dao.Insert(ctx, map[string]interface{}{"name": name, "age": 10 + i})
+		if err != nil || id != int64(i+1) {
+			t.Fatalf("Insert(%s) = %d, %v, want %d", name, id, err, i+1)
+		}
+	}
+
+	var u sqliteUser
+	if err := dao.FindByKey(ctx, 2, &u); err != nil || u.Name != "jerry" {
+		t.Errorf("FindByKey(2) = %+v, %v, want jerry", u, err)
+	}
+	if err := dao.First(ctx, map[string]interface{}{"age >": 10, "_orderby": "age desc"}, &u); err != nil || u.Name != "spike" {
+		t.Errorf("First() = %+v, %v, want spike", u, err)
+	}
+	var users []sqliteUser
+	if err := dao.Find(ctx, map[string]interface{}{"_orderby": "id"}, 1, 10, &users); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(users) != 2 || users[0].Name != "jerry" || users[1].Name != "spike" {
+		t.Errorf("Find() = %+v, want [jerry spike]", users)
+	}
+	if n, err := dao.Count(ctx, map[string]interface{}{"age >=": 11}); err != nil || n != 2 {
+		t.Errorf("Count() = %d, %v, want 2", n, err)
+	}
+
+	if n, err := dao.UpdateByKey(ctx, 1, map[string]interface{}{"age": 20}); err != nil || n != 1 {
+		t.Errorf("UpdateByKey() = %d, %v, want 1", n, err)
+	}
+	if n, err := dao.Update(ctx, map[string]interface{}{"age <": 20}, map[string]interface{}{"name": "young"}); err != nil || n != 2 {
+		t.Errorf("Update() = %d, %v, want 2", n, err)
+	}
+	if err := dao.FindByKey(ctx, 1, &u); err != nil || u.Age != 20 || u.Name != "tom" {
+		t.Errorf("FindByKey(1) = %+v, %v, want tom aged 20", u, err)
+	}
+
+	tx, err := mysqlconfig.BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.TXInsert(ctx, tx.Tx, map[string]interface{}{"name": "tyke", "age": 1}); err != nil {
+		t.Fatalf("TXInsert() error = %v", err)
+	}
+	if n, err := dao.TXDeleteByKey(ctx, tx.Tx, 1); err != nil || n != 1 {
+		t.Errorf("TXDeleteByKey() = %d, %v, want 1", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := dao.FindByKey(ctx, 1, &u); !errors.Is(err, scanner.ErrEmptyResult) {
+		t.Errorf("FindByKey(1) error = %v, want ErrEmptyResult", err)
+	}
+
+	if n, err := dao.Delete(ctx, map[string]interface{}{"name": "young"}); err != nil || n != 2 {
+		t.Errorf("Delete() = %d, %v, want 2", n, err)
+	}
+	if n, err := dao.DeleteByKey(ctx, 4); err != nil || n != 1 {
+		t.Errorf("DeleteByKey() = %d, %v, want 1", n, err)
+	}
+	if n, err := dao.Count(ctx, nil); err != nil || n != 0 {
+		t.Errorf("Count() = %d, %v, want 0", n, err)
+	}
+}
+
+func TestSQLDao_sqliteShardFindOrder(t *testing.T) {
+	_, cleanup := openSQLite(t, "lite", mysqlconfig.Config{},
+		`CREATE TABLE users_0 (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER NOT NULL)`,
+		`CREATE TABLE users_1 (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER NOT NULL)`)
+	defer cleanup()
+	dao := NewSQLDao("users", "lite", "id", &SQLDaoOption{
+		SelectOrder: "age desc",
+		Sharding:    &ShardRule{Key: "id", Strategy: ShardModulo, Shards: []Shard{{Suffix: "_0"}, {Suffix: "_1"}}},
+	})
+	ctx := context.Background()
+	// 年龄与分片交错
+	for id, age := range []int{30, 50, 10, 40, 20, 60} {
+		if _, err := dao.Insert(ctx, map[string]interface{}{"id": id, "name": "u", "age": age}); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	ages := func(users []sqliteUser) []int {
+		out := make([]int, len(users))
+		for i, u := range users {
+			out[i] = u.Age
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		where  map[string]interface{}
+		offset uint
+		want   []int
+	}{
+		{"select order", nil, 1, []int{50, 40, 30}},
+		{"orderby", map[string]interface{}{"_orderby": "age"}, 2, []int{30, 40, 50}},
+		{"two columns", map[string]interface{}{"age >": 15, "_orderby": "name, id desc"}, 0, []int{60, 20, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var users []sqliteUser
+			if err := dao.Find(ctx, tt.where, tt.offset, 3, &users); err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if got := ages(users); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() ages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 跨分片的 First 按排序取最前的记录
+	firsts := []struct {
+		name  string
+		where map[string]interface{}
+		want  int
+	}{
+		{"select order", nil, 60},
+		{"orderby", map[string]interface{}{"_orderby": "age"}, 10},
+		{"condition", map[string]interface{}{"age <": 45, "_orderby": "age desc"}, 40},
+	}
+	for _, tt := range firsts {
+		t.Run("first "+tt.name, func(t *testing.T) {
+			var u sqliteUser
+			if err := dao.First(ctx, tt.where, &u); err != nil || u.Age != tt.want {
+				t.Errorf("First() = %+v, %v, want age %d", u, err, tt.want)
+			}
+		})
+	}
+	var u sqliteUser
+	if err := dao.First(ctx, map[string]interface{}{"age >": 100}, &u); !errors.Is(err, scanner.ErrEmptyResult) {
+		t.Errorf("First() error = %v, want ErrEmptyResult", err)
+	}
+	if err := dao.FindByKey(ctx, 3, &u); err != nil || u.Age != 40 {
+		t.Errorf("FindByKey(3) = %+v, %v, want age 40", u, err)
+	}
+	unordered := NewSQLDao("users", "lite", "id", &SQLDaoOption{Sharding: dao.sharding})
+	if err := unordered.First(ctx, nil, &u); err == nil || !strings.Contains(err.Error(), "without _orderby") {
+		t.Errorf("First() without order error = %v", err)
+	}
+}
+
+func TestSQLDao_insertInvalidatesMissing(t *testing.T) {
+	fake := miniredis.RunT(t)
+	rc := redisconfig.Configs{"cache": &redisconfig.Config{Addr: fake.Addr(), MaxRetries: -1, HealthCheckInterval: -1}}
+	if err := rc.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer rc.Close()
+	db, cleanup := openSQLite(t, "rows", mysqlconfig.Config{},
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL DEFAULT '')`,
+		`INSERT INTO sqlite_sequence (name, seq) VALUES ('users', 4)`)
+	defer cleanup()
+
+	dao := NewSQLDao("users", "rows", "id", &SQLDaoOption{Cache: &CacheOption{Handle: "cache", NegativeTTL: time.Minute}})
+	ctx := context.Background()
+	missing := string(cacheMissing)
+	for _, k := range []string{"users:5", "users:9", "users:10"} {
+		fake.Set(k, missing)
+	}
+
+	// 无主键时按自增 id 删除
+	if _, err := dao.Insert(ctx, map[string]interface{}{"name": "tom"}); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if fake.Exists("users:5") {
+		t.Error("users:5 should be invalidated after Insert")
+	}
+	if _, err := dao.Insert(ctx, map[string]interface{}{"id": 9, "name": "tom"}); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if fake.Exists("users:9") {
+		t.Error("users:9 should be invalidated after Insert")
+	}
+
+	tx, err := mysqlconfig.BeginTx(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.TXInsert(ctx, tx.Tx, map[string]interface{}{"id": 10}); err != nil {
+		t.Fatalf("TXInsert() error = %v", err)
+	}
+	if fake.Exists("users:10") {
+		t.Error("users:10 should be invalidated before commit")
+	}
+	// 提交前的并发读取写回未找到
+	fake.Set("users:10", missing)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if fake.Exists("users:10") {
+		t.Error("users:10 should be invalidated after commit")
+	}
+}
+
+// 未指定时间下界且 Retention 为 0 时查询已存在的分区
+func TestSQLDao_sqlitePartitionScan(t *testing.T) {
+	_, cleanup := openSQLite(t, "lite", mysqlconfig.Config{},
+		`CREATE TABLE orders_202608 (id INTEGER PRIMARY KEY, amount INTEGER NOT NULL, created_at DATETIME NOT NULL)`,
+		`CREATE TABLE orders_202609 (id INTEGER PRIMARY KEY, amount INTEGER NOT NULL, created_at DATETIME NOT NULL)`,
+		`CREATE TABLE orders_archive (id INTEGER PRIMARY KEY, amount INTEGER NOT NULL, created_at DATETIME NOT NULL)`)
+	defer cleanup()
+	dao := NewSQLDao("orders", "lite", "id", &SQLDaoOption{
+		Partition: &PartitionRule{Key: "created_at", Location: time.UTC},
+	})
+	ctx := context.Background()
+	rows := []struct {
+		id, amount int
+		at         time.Time
+	}{
+		{1, 30, time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{2, 50, time.Date(2026, 8, 20, 0, 0, 0, 0, time.UTC)},
+		{3, 40, time.Date(2026, 9, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, r := range rows {
+		if _, err := dao.Insert(ctx, map[string]interface{}{"id": r.id, "amount": r.amount, "created_at": r.at}); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	type order struct {
+		ID     int64 `ddb:"id"`
+		Amount int   `ddb:"amount"`
+	}
+	var o order
+	if err := dao.FindByKey(ctx, 3, &o); err != nil || o.Amount != 40 {
+		t.Errorf("FindByKey(3) = %+v, %v, want amount 40", o, err)
+	}
+	if err := dao.FindByKey(ctx, 9, &o); !errors.Is(err, scanner.ErrEmptyResult) {
+		t.Errorf("FindByKey(9) error = %v, want ErrEmptyResult", err)
+	}
+	if n, err := dao.Count(ctx, nil); err != nil || n != 3 {
+		t.Errorf("Count() = %d, %v, want 3", n, err)
+	}
+	if err := dao.First(ctx, map[string]interface{}{"_orderby": "amount desc"}, &o); err != nil || o.ID != 2 {
+		t.Errorf("First() = %+v, %v, want id 2", o, err)
+	}
+	if err := dao.First(ctx, map[string]interface{}{"amount >": 0}, &o); err == nil || !strings.Contains(err.Error(), "without _orderby") {
+		t.Errorf("First() without order error = %v", err)
+	}
+	var orders []order
+	if err := dao.Find(ctx, map[string]interface{}{"created_at <": "2026-09-01", "_orderby": "amount"}, 0, 10, &orders); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != 1 || orders[1].ID != 2 {
+		t.Errorf("Find() = %+v, want ids [1 2]", orders)
+	}
+}
+
+func TestCheckSchema_sqlitePartitions(t *testing.T) {
+	_, cleanup := openSQLite(t, "lite", mysqlconfig.Config{},
+		`CREATE TABLE orders_202608 (id INTEGER PRIMARY KEY, amount INTEGER NOT NULL)`,
+		`CREATE TABLE orders_202609 (id INTEGER PRIMARY KEY)`,
+		`CREATE TABLE orders_209901 (id INTEGER PRIMARY KEY, amount INTEGER)`)
+	defer cleanup()
+	records.Lock()
+	saved := records.items
+	records.items = nil
+	records.Unlock()
+	defer func() {
+		records.Lock()
+		records.items = saved
+		records.Unlock()
+	}()
+
+	type order struct {
+		ID     int64 `ddb:"id"`
+		Amount int   `ddb:"amount"`
+	}
+	RegisterRecord(NewSQLDao("orders", "lite", "id", &SQLDaoOption{
+		Partition: &PartitionRule{Key: "created_at", Location: time.UTC},
+	}), order{})
+	drifts, err := CheckSchema(context.Background())
+	if err != nil {
+		t.Fatalf("CheckSchema() error = %v", err)
+	}
+	want := []string{
+		"[lite] orders_202609.amount (order.Amount): column not found, field always zero",
+		"[lite] orders_209901.amount (order.Amount): column nullable, field type int cannot hold NULL",
+	}
+	got := make([]string, len(drifts))
+	for i, d := range drifts {
+		got[i] = d.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckSchema() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
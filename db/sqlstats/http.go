@@ -0,0 +1,63 @@
+package sqlstats
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultTopN = 20
+
+var page = template.Must(template.New("sqlstats").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>sql stats</title>
+<style>
+body{font-family:monospace;font-size:13px}
+table{border-collapse:collapse}
+th,td{border:1px solid #ccc;padding:2px 6px;text-align:right}
+td.fp{text-align:left;max-width:900px;word-break:break-all}
+</style>
+</head>
+<body>
+<h3>top {{.N}} queries by total time since {{.Since.Format "2006-01-02 15:04:05"}}</h3>
+<table>
+<tr><th>handle</th><th>fingerprint</th><th>count</th><th>errors</th><th>total</th><th>avg</th><th>p50</th><th>p90</th><th>p99</th><th>max</th></tr>
+{{range .Stats}}<tr><td>{{.Handle}}</td><td class="fp">{{.Fingerprint}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td>{{.Total}}</td><td>{{.Avg}}</td><td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P99}}</td><td>{{.Max}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// 调试页面, 参数 n 为条数, format=json 时输出 json, POST reset=1 清空统计
+func (a *Aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && r.FormValue("reset") == "1" {
+		a.Reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	n := defaultTopN
+	if v := r.FormValue("n"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			n = i
+		}
+	}
+	stats := a.Top(n)
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(stats)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.Execute(w, struct {
+		N     int
+		Since time.Time
+		Stats []Stat
+	}{N: n, Since: a.Since(), Stats: stats})
+}
+
+// 默认聚合器的调试页面
+func Handler() http.Handler {
+	return Default
+}
@@ -0,0 +1,187 @@
+// 按 sql 指纹聚合语句执行次数、错误数及耗时分位数
+package sqlstats
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/db/sqlfmt"
+)
+
+const (
+	// 每个指纹保留的耗时样本数
+	defaultSamples = 1024
+	// 语句到指纹的缓存上限
+	maxCachedQueries = 10000
+)
+
+var Default = NewAggregator(defaultSamples)
+
+type Stat struct {
+	Handle      string        `json:"handle"`
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Total       time.Duration `json:"total"`
+	Max         time.Duration `json:"max"`
+	P50         time.Duration `json:"p50"`
+	P90         time.Duration `json:"p90"`
+	P99         time.Duration `json:"p99"`
+}
+
+// 平均耗时
+func (s Stat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+type key struct {
+	handle      string
+	fingerprint string
+}
+
+type entry struct {
+	count   int64
+	errors  int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+type Aggregator struct {
+	mu         sync.Mutex
+	maxSamples int
+	entries    map[key]*entry
+	// 语句到指纹的缓存
+	fingerprints map[string]string
+	since        time.Time
+}
+
+func NewAggregator(samples int) *Aggregator {
+	if samples <= 0 {
+		samples = defaultSamples
+	}
+	return &Aggregator{
+		maxSamples:   samples,
+		entries:      map[key]*entry{},
+		fingerprints: map[string]string{},
+		since:        time.Now(),
+	}
+}
+
+// 记录一次执行
+func (a *Aggregator) Record(handle string, query string, cost time.Duration, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fp, ok := a.fingerprints[query]
+	if !ok {
+		fp = sqlfmt.Fingerprint(query)
+		if len(a.fingerprints) >= maxCachedQueries {
+			a.fingerprints = map[string]string{}
+		}
+		a.fingerprints[query] = fp
+	}
+	k := key{handle: handle, fingerprint: fp}
+	e, ok := a.entries[k]
+	if !ok {
+		e = &entry{}
+		a.entries[k] = e
+	}
+	e.count++
+	if err != nil {
+		e.errors++
+	}
+	e.total += cost
+	if cost > e.max {
+		e.max = cost
+	}
+	// 蓄水池抽样
+	if len(e.samples) < a.maxSamples {
+		e.samples = append(e.samples, cost)
+	} else if i := rand.Int63n(e.count); i < int64(a.maxSamples) {
+		e.samples[i] = cost
+	}
+}
+
+// 按总耗时倒序返回前 n 条, n <= 0 时返回全部
+func (a *Aggregator) Top(n int) []Stat {
+	a.mu.Lock()
+	stats := make([]Stat, 0, len(a.entries))
+	samples := make([][]time.Duration, 0, len(a.entries))
+	for k, e := range a.entries {
+		stats = append(stats, Stat{
+			Handle:      k.handle,
+			Fingerprint: k.fingerprint,
+			Count:       e.count,
+			Errors:      e.errors,
+			Total:       e.total,
+			Max:         e.max,
+		})
+		samples = append(samples, append([]time.Duration(nil), e.samples...))
+	}
+	a.mu.Unlock()
+
+	for i := range stats {
+		s := samples[i]
+		sort.Slice(s, func(x, y int) bool { return s[x] < s[y] })
+		stats[i].P50 = percentile(s, 0.50)
+		stats[i].P90 = percentile(s, 0.90)
+		stats[i].P99 = percentile(s, 0.99)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Fingerprint < stats[j].Fingerprint
+	})
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// 统计开始时间
+func (a *Aggregator) Since() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.since
+}
+
+// 清空统计
+func (a *Aggregator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = map[key]*entry{}
+	a.fingerprints = map[string]string{}
+	a.since = time.Now()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func Record(handle string, query string, cost time.Duration, err error) {
+	Default.Record(handle, query, cost, err)
+}
+
+func Top(n int) []Stat {
+	return Default.Top(n)
+}
+
+func Reset() {
+	Default.Reset()
+}
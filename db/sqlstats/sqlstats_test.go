@@ -0,0 +1,39 @@
+package sqlstats
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAggregator_Top(t *testing.T) {
+	a := NewAggregator(1000)
+	for i := 1; i <= 100; i++ {
+		a.Record("db1", "SELECT * FROM users WHERE id IN (?,?)", time.Duration(i)*time.Millisecond, nil)
+	}
+	a.Record("db1", "SELECT * FROM users WHERE id IN (?,?,?)", time.Second, errors.New("timeout"))
+	a.Record("db1", "UPDATE users SET name=? WHERE id=?", 3*time.Second, nil)
+	a.Record("db2", "UPDATE users SET name=? WHERE id=?", time.Millisecond, nil)
+
+	top := a.Top(2)
+	if len(top) != 2 {
+		t.Fatalf("Top(2) len = %d", len(top))
+	}
+	if top[1].Fingerprint != "update users set name=? where id=?" || top[1].Handle != "db1" {
+		t.Errorf("Top(2)[1] = %+v", top[1])
+	}
+	select1 := top[0]
+	if select1.Fingerprint != "select * from users where id in (?+)" || select1.Count != 101 || select1.Errors != 1 {
+		t.Errorf("Top(2)[0] = %+v", select1)
+	}
+	if select1.P50 != 51*time.Millisecond || select1.P99 != 100*time.Millisecond || select1.Max != time.Second {
+		t.Errorf("percentiles = %v %v %v", select1.P50, select1.P99, select1.Max)
+	}
+	if len(a.Top(0)) != 3 {
+		t.Errorf("Top(0) should return all stats")
+	}
+	a.Reset()
+	if len(a.Top(0)) != 0 {
+		t.Errorf("Reset() should clear stats")
+	}
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/db/sqlfmt"
+	"github.com/zhouchang2017/toolkit/db/sqlstats"
+)
+
+// 语句日志使用 sqlfmt 生成指纹及脱敏参数, query_stats 记录到 sqlstats
+type statementHooks struct{}
+
+func (statementHooks) Fingerprint(query string) string {
+	return sqlfmt.Fingerprint(query)
+}
+
+func (statementHooks) MaskArgs(args []interface{}) []string {
+	return sqlfmt.MaskArgs(args)
+}
+
+func (statementHooks) Record(handle string, query string, cost time.Duration, err error) {
+	sqlstats.Record(handle, query, cost, err)
+}
+
+func init() {
+	mysqlconfig.RegisterStatementHooks(statementHooks{})
+}
+
+// 只读查询, 读取结果后才释放并发许可并记录耗时, 非事务时按连接的重试策略重试临时错误
+// scan 返回的错误(如未找到记录)不计入熔断的错误率
+func (s SQLDao) query(ctx context.Context, db dbExecutor, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	ctx = mysqlconfig.WithTable(ctx, s.tableName)
+	attempt := func() error {
+		done, err := s.acquire(ctx, db)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		var scanErr error
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err == nil {
+			scanErr = scan(rows)
+			err = rows.Err()
+			rows.Close()
+		}
+		done(err)
+		s.observe(ctx, query, args, start, -1, err)
+		if err != nil {
+			return err
+		}
+		return scanErr
+	}
+	if _, ok := db.(*sql.Tx); ok {
+		// 事务内的语句不能单独重试
+		return attempt()
+	}
+	return mysqlconfig.Retry(ctx, s.handleName, attempt)
+}
+
+// 执行语句并记录影响行数
+func (s SQLDao) exec(ctx context.Context, db dbExecutor, query string, args []interface{}) (sql.Result, error) {
+	ctx = mysqlconfig.WithTable(ctx, s.tableName)
+	done, err := s.acquire(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	result, err := db.ExecContext(ctx, query, args...)
+	done(err)
+	rows := int64(-1)
+	if err == nil && result != nil {
+		if n, e := result.RowsAffected(); e == nil {
+			rows = n
+		}
+	}
+	s.observe(ctx, query, args, start, rows, err)
+	return result, err
+}
+
+// 查询单行, 用于 RETURNING 语句
+func (s SQLDao) queryRow(ctx context.Context, db dbExecutor, query string, args []interface{}, dest ...interface{}) error {
+	ctx = mysqlconfig.WithTable(ctx, s.tableName)
+	done, err := s.acquire(ctx, db)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	done(err)
+	rows := int64(1)
+	if err != nil {
+		rows = -1
+	}
+	s.observe(ctx, query, args, start, rows, err)
+	return err
+}
+
+// 熔断及并发隔离, 事务内的语句由 utils.Transaction 整体控制
+func (s SQLDao) acquire(ctx context.Context, db dbExecutor) (func(err error), error) {
+	if _, ok := db.(*sql.Tx); ok {
+		return func(error) {}, nil
+	}
+	return mysqlconfig.Acquire(ctx, s.handleName)
+}
+
+func (s SQLDao) observe(ctx context.Context, query string, args []interface{}, start time.Time, rows int64, err error) {
+	mysqlconfig.Observe(ctx, s.handleName, mysqlconfig.Statement{
+		Table: s.tableName,
+		Query: query,
+		Args:  args,
+		Rows:  rows,
+		Cost:  time.Since(start),
+		Err:   err,
+	})
+}
@@ -0,0 +1,80 @@
+//go:build cgo
+// +build cgo
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+func TestSQLDao_queryHoldsBulkheadWhileScanning(t *testing.T) {
+	// 读取视图的每一行都会调用 on_row()
+	_, cleanup := openSQLite(t, "rows", mysqlconfig.Config{Bulkhead: mysqlconfig.BulkheadConfig{MaxConcurrent: 1}},
+		`CREATE TABLE items (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO items (id) VALUES (1), (2)`,
+		`CREATE VIEW t AS SELECT id, on_row() AS probe FROM items`)
+	defer cleanup()
+
+	var scanned int
+	var acquireErr error
+	setOnRow(func() {
+		scanned++
+		// 读取结果期间许可仍被占用
+		done, err := mysqlconfig.Acquire(context.Background(), "rows")
+		if err == nil {
+			done(nil)
+		}
+		acquireErr = err
+	})
+	defer setOnRow(nil)
+
+	type row struct {
+		ID int64 `ddb:"id"`
+	}
+	var rows []row
+	dao := NewSQLDao("t", "rows", "id", nil)
+	if err := dao.Find(context.Background(), nil, 0, 10, &rows); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if scanned != 2 || len(rows) != 2 {
+		t.Fatalf("scanned %d rows, got %v", scanned, rows)
+	}
+	if !errors.Is(acquireErr, mysqlconfig.ErrUnavailable) {
+		t.Errorf("Acquire() while scanning error = %v, want ErrUnavailable", acquireErr)
+	}
+	done, err := mysqlconfig.Acquire(context.Background(), "rows")
+	if err != nil {
+		t.Fatalf("Acquire() after scanning error = %v", err)
+	}
+	done(nil)
+}
+
+func TestSQLDao_slowLogFingerprint(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = log.NewZapLogger("json", false, "debug", &buf)
+	defer func() { log.Logger = logger }()
+
+	_, cleanup := openSQLite(t, "slow", mysqlconfig.Config{SlowThreshold: time.Nanosecond}, usersTable)
+	defer cleanup()
+
+	dao := NewSQLDao("users", "slow", "id", nil)
+	if _, err := dao.Update(context.Background(), map[string]interface{}{"id": 1}, map[string]interface{}{"name": "secret"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	// db 包注册的钩子生成指纹并脱敏参数
+	out := buf.String()
+	for _, want := range []string{`"fingerprint":"update users set name=? where (id=?)"`, `'***'(6)`, "slow sql"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log %s does not contain %s", out, want)
+		}
+	}
+}
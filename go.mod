@@ -1,14 +1,17 @@
 module github.com/zhouchang2017/toolkit
 
-go 1.13
+go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.4
 	github.com/davecgh/go-spew v1.1.1
-	github.com/didi/gendry v1.6.0 // indirect
+	github.com/didi/gendry v1.6.0
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-redis/redis/v8 v8.3.3
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/lestrrat-go/strftime v1.0.1 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/mitchellh/mapstructure v1.1.2
 	github.com/patch-mirrors/file-rotatelogs v2.2.1+incompatible
 	github.com/rifflock/lfshook v0.0.0-20180920164130-b9218ef580f5
 	github.com/sirupsen/logrus v1.6.0
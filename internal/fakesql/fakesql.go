@@ -0,0 +1,168 @@
+// 测试用 sql 驱动, 由测试决定建立连接及执行语句的结果, 用于注入连接失败、连接断开、加锁失败等故障
+package fakesql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// 语句的执行结果, 查询返回 Columns 及 Rows, 写入语句返回 LastInsertID 及 RowsAffected
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	LastInsertID int64
+	RowsAffected int64
+}
+
+// 语句处理方法, dsn 为连接使用的 dsn
+type Handler func(dsn, query string, args []driver.NamedValue) (*Result, error)
+
+type Driver struct {
+	mu      sync.Mutex
+	dial    func(dsn string) error
+	handler Handler
+	dsns    []string
+	queries []string
+}
+
+// 建立连接时调用 fn, 返回错误时连接失败
+func (d *Driver) OnDial(fn func(dsn string) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dial = fn
+}
+
+// 执行语句时调用 fn, 未设置时查询返回空结果
+func (d *Driver) Handle(fn Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handler = fn
+}
+
+// 清除处理方法及记录
+func (d *Driver) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dial, d.handler, d.dsns, d.queries = nil, nil, nil, nil
+}
+
+// 已建立连接的 dsn
+func (d *Driver) DSNs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.dsns...)
+}
+
+// 已执行的语句
+func (d *Driver) Queries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.queries...)
+}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	dial := d.dial
+	d.mu.Unlock()
+	if dial != nil {
+		if err := dial(dsn); err != nil {
+			return nil, err
+		}
+	}
+	d.mu.Lock()
+	d.dsns = append(d.dsns, dsn)
+	d.mu.Unlock()
+	return &conn{driver: d, dsn: dsn}, nil
+}
+
+func (d *Driver) run(dsn, query string, args []driver.NamedValue) (*Result, error) {
+	d.mu.Lock()
+	d.queries = append(d.queries, query)
+	handler := d.handler
+	d.mu.Unlock()
+	if handler == nil {
+		return &Result{}, nil
+	}
+	res, err := handler(dsn, query, args)
+	if err == nil && res == nil {
+		res = &Result{}
+	}
+	return res, err
+}
+
+type conn struct {
+	driver *Driver
+	dsn    string
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *conn) Commit() error {
+	return nil
+}
+
+func (c *conn) Rollback() error {
+	return nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.driver.run(c.dsn, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result{res}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.driver.run(c.dsn, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: res.Columns, rows: res.Rows}, nil
+}
+
+type result struct {
+	*Result
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.LastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.Result.RowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,218 @@
+// 连接池指标采集, 以 Prometheus 文本格式输出
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+const (
+	gauge   = "gauge"
+	counter = "counter"
+
+	defaultInterval = 15 * time.Second
+)
+
+type metric struct {
+	name string
+	help string
+	typ  string
+}
+
+var (
+	mysqlMaxOpen           = &metric{"toolkit_mysql_max_open_connections", "Maximum number of open connections to the database.", gauge}
+	mysqlOpen              = &metric{"toolkit_mysql_open_connections", "The number of established connections both in use and idle.", gauge}
+	mysqlInUse             = &metric{"toolkit_mysql_in_use_connections", "The number of connections currently in use.", gauge}
+	mysqlIdle              = &metric{"toolkit_mysql_idle_connections", "The number of idle connections.", gauge}
+	mysqlWaitCount         = &metric{"toolkit_mysql_wait_count_total", "The total number of connections waited for.", counter}
+	mysqlWaitDuration      = &metric{"toolkit_mysql_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", counter}
+	mysqlMaxIdleClosed     = &metric{"toolkit_mysql_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.", counter}
+	mysqlMaxIdleTimeClosed = &metric{"toolkit_mysql_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.", counter}
+	mysqlMaxLifetimeClosed = &metric{"toolkit_mysql_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.", counter}
+
+	redisHits       = &metric{"toolkit_redis_pool_hits_total", "The number of times free connection was found in the pool.", counter}
+	redisMisses     = &metric{"toolkit_redis_pool_misses_total", "The number of times free connection was NOT found in the pool.", counter}
+	redisTimeouts   = &metric{"toolkit_redis_pool_timeouts_total", "The number of times a wait timeout occurred.", counter}
+	redisTotalConns = &metric{"toolkit_redis_pool_total_connections", "The number of total connections in the pool.", gauge}
+	redisIdleConns  = &metric{"toolkit_redis_pool_idle_connections", "The number of idle connections in the pool.", gauge}
+	redisStaleConns = &metric{"toolkit_redis_pool_stale_connections_total", "The number of stale connections removed from the pool.", counter}
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	metric *metric
+	labels []label
+	value  float64
+}
+
+// 定时采集 mysqlconfig 及 redisconfig 连接池状态
+type Collector struct {
+	interval time.Duration
+	logger   log.FieldLogger
+
+	mu      sync.RWMutex
+	samples []sample
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// logger 为 nil 时不输出日志
+func NewCollector(interval time.Duration, logger log.FieldLogger) *Collector {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Collector{interval: interval, logger: logger, stop: make(chan struct{})}
+}
+
+// 启动后台采集
+func (c *Collector) Start() {
+	c.Collect()
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.Collect()
+			}
+		}
+	}()
+}
+
+func (c *Collector) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// 立即采集一次
+func (c *Collector) Collect() {
+	samples := make([]sample, 0)
+	for _, stat := range mysqlconfig.PoolStats() {
+		labels := []label{{"handle", stat.Name}, {"role", stat.Role}, {"addr", stat.Addr}}
+		s := stat.Stats
+		samples = append(samples,
+			sample{mysqlMaxOpen, labels, float64(s.MaxOpenConnections)},
+			sample{mysqlOpen, labels, float64(s.OpenConnections)},
+			sample{mysqlInUse, labels, float64(s.InUse)},
+			sample{mysqlIdle, labels, float64(s.Idle)},
+			sample{mysqlWaitCount, labels, float64(s.WaitCount)},
+			sample{mysqlWaitDuration, labels, s.WaitDuration.Seconds()},
+			sample{mysqlMaxIdleClosed, labels, float64(s.MaxIdleClosed)},
+			sample{mysqlMaxIdleTimeClosed, labels, float64(s.MaxIdleTimeClosed)},
+			sample{mysqlMaxLifetimeClosed, labels, float64(s.MaxLifetimeClosed)},
+		)
+		if c.logger != nil {
+			c.logger.WithFields(map[string]interface{}{
+				"handle":      stat.Name,
+				"role":        stat.Role,
+				"addr":        stat.Addr,
+				"max_open":    s.MaxOpenConnections,
+				"open":        s.OpenConnections,
+				"in_use":      s.InUse,
+				"idle":        s.Idle,
+				"wait_count":  s.WaitCount,
+				"wait_ms":     s.WaitDuration.Milliseconds(),
+				"idle_closed": s.MaxIdleClosed + s.MaxIdleTimeClosed,
+				"life_closed": s.MaxLifetimeClosed,
+			}).Info("mysql pool stats")
+		}
+	}
+
+	stats := redisconfig.PoolStats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := stats[name]
+		labels := []label{{"handle", name}}
+		samples = append(samples,
+			sample{redisHits, labels, float64(s.Hits)},
+			sample{redisMisses, labels, float64(s.Misses)},
+			sample{redisTimeouts, labels, float64(s.Timeouts)},
+			sample{redisTotalConns, labels, float64(s.TotalConns)},
+			sample{redisIdleConns, labels, float64(s.IdleConns)},
+			sample{redisStaleConns, labels, float64(s.StaleConns)},
+		)
+		if c.logger != nil {
+			c.logger.WithFields(map[string]interface{}{
+				"handle":      name,
+				"hits":        s.Hits,
+				"misses":      s.Misses,
+				"timeouts":    s.Timeouts,
+				"total_conns": s.TotalConns,
+				"idle_conns":  s.IdleConns,
+				"stale_conns": s.StaleConns,
+			}).Info("redis pool stats")
+		}
+	}
+
+	c.mu.Lock()
+	c.samples = samples
+	c.mu.Unlock()
+}
+
+// 以 Prometheus 文本格式输出最近一次采集结果
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	body := render(c.samples)
+	c.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(body)
+}
+
+func render(samples []sample) []byte {
+	var buf bytes.Buffer
+	var last *metric
+	// 同一指标的样本需连续输出
+	sorted := make([]sample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].metric.name < sorted[j].metric.name
+	})
+	for _, s := range sorted {
+		if s.metric != last {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", s.metric.name, s.metric.help)
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", s.metric.name, s.metric.typ)
+			last = s.metric
+		}
+		buf.WriteString(s.metric.name)
+		if len(s.labels) > 0 {
+			buf.WriteByte('{')
+			for i, l := range s.labels {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				buf.WriteString(l.name)
+				buf.WriteString(`="`)
+				buf.WriteString(labelEscaper.Replace(l.value))
+				buf.WriteByte('"')
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
@@ -0,0 +1,57 @@
+//go:build cgo
+// +build cgo
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+func TestCollector_sqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+	configs := &mysqlconfig.Configs{"lite": {Driver: "sqlite3", DB: path, MaxOpenConn: 5}}
+	if err := configs.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer configs.Close()
+
+	c := NewCollector(0, nil)
+	c.Collect()
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	labels := `{handle="lite",role="primary",addr="` + path + `"}`
+	for _, want := range []string{
+		"# TYPE toolkit_mysql_max_open_connections gauge\n",
+		"toolkit_mysql_max_open_connections" + labels + " 5\n",
+		"toolkit_mysql_open_connections" + labels + " 1\n",
+		"toolkit_mysql_idle_connections" + labels + " 1\n",
+		"toolkit_mysql_in_use_connections" + labels + " 0\n",
+		"# TYPE toolkit_mysql_wait_count_total counter\n",
+		"toolkit_mysql_wait_count_total" + labels + " 0\n",
+		"toolkit_mysql_wait_duration_seconds_total" + labels + " 0\n",
+		"toolkit_mysql_max_idle_closed_total" + labels + " 0\n",
+		"toolkit_mysql_max_idle_time_closed_total" + labels + " 0\n",
+		"toolkit_mysql_max_lifetime_closed_total" + labels + " 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	samples := []sample{
+		{mysqlOpen, []label{{"handle", "db1"}, {"role", "primary"}}, 3},
+		{redisHits, []label{{"handle", `a"b`}}, 10},
+		{mysqlOpen, []label{{"handle", "db2"}, {"role", "replica"}}, 1.5},
+	}
+	want := `# HELP toolkit_mysql_open_connections The number of established connections both in use and idle.
+# TYPE toolkit_mysql_open_connections gauge
+toolkit_mysql_open_connections{handle="db1",role="primary"} 3
+toolkit_mysql_open_connections{handle="db2",role="replica"} 1.5
+# HELP toolkit_redis_pool_hits_total The number of times free connection was found in the pool.
+# TYPE toolkit_redis_pool_hits_total counter
+toolkit_redis_pool_hits_total{handle="a\"b"} 10
+`
+	if got := string(render(samples)); got != want {
+		t.Errorf("render() = %v, want %v", got, want)
+	}
+}
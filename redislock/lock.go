@@ -0,0 +1,328 @@
+// 基于 redisconfig 客户端的分布式锁, 支持自动续期、重试、fencing token 及 Redlock
+package redislock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+	"github.com/zhouchang2017/toolkit/log"
+)
+
+var (
+	// 锁被其他持有者占用
+	ErrNotObtained = errors.New("redislock: not obtained")
+	// 锁已过期或被其他持有者获取
+	ErrNotHeld = errors.New("redislock: lock not held")
+	// Redlock 的各配置段计数相互独立, 无法提供单调递增的 fencing token
+	ErrNoFence = errors.New("redislock: fencing token not supported by redlock")
+)
+
+// redlock 有效期扣除的时钟漂移系数
+const clockDriftFactor = 0.01
+
+var (
+	// 获取成功时递增 fencing 计数并返回
+	obtainScript = redis.NewScript(`if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`)
+	// Redlock 不维护 fencing 计数
+	acquireScript = redis.NewScript(`if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0`)
+	refreshScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+type Options struct {
+	// 获取失败时的重试策略, 默认不重试
+	Retry RetryStrategy
+	// 持有期间每 ttl/3 自动续期, 确认失去锁时关闭 Lock.Lost
+	AutoRefresh bool
+	// key 前缀
+	Prefix string
+}
+
+type Locker struct {
+	handles []string
+	quorum  int
+	opt     Options
+}
+
+// 使用单个 redisconfig 配置段
+func New(handle string, opt *Options) *Locker {
+	return NewRedlock([]string{handle}, opt)
+}
+
+// 使用多个相互独立的 redisconfig 配置段, 在多数配置段上获取成功且未超过有效期时获取成功
+func NewRedlock(handles []string, opt *Options) *Locker {
+	l := &Locker{handles: handles, quorum: len(handles)/2 + 1}
+	if opt != nil {
+		l.opt = *opt
+	}
+	if l.opt.Retry == nil {
+		l.opt.Retry = NoRetry()
+	}
+	return l
+}
+
+// 获取锁, 按重试策略重试, 锁被占用时返回 ErrNotObtained, redis 错误时返回最后一次的错误
+func (l *Locker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	if len(l.handles) == 0 {
+		return nil, errors.New("redislock: no redis handle")
+	}
+	if ttl < time.Millisecond {
+		return nil, errors.New("redislock: ttl must not be less than 1ms")
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	// 以 {key} 存储, cluster 模式下锁与 fencing 计数位于同一 slot
+	lock := &Lock{
+		locker:   l,
+		key:      l.opt.Prefix + "{" + key + "}",
+		token:    token,
+		ttl:      ttl,
+		stop:     make(chan struct{}),
+		lost:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	lock.fenceKey = lock.key + ":fence"
+	for attempt := 1; ; attempt++ {
+		ok, err := lock.obtain(ctx)
+		if ok {
+			if l.opt.AutoRefresh {
+				go lock.keepAlive()
+			} else {
+				close(lock.released)
+			}
+			return lock, nil
+		}
+		backoff := l.opt.Retry.NextBackoff(attempt)
+		if backoff <= 0 {
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrNotObtained
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// 已获取的锁
+type Lock struct {
+	locker   *Locker
+	key      string
+	fenceKey string
+	token    string
+	ttl      time.Duration
+
+	mu    sync.RWMutex
+	fence int64
+	until time.Time
+
+	once     sync.Once
+	stop     chan struct{}
+	lost     chan struct{}
+	released chan struct{}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// 持有者标识, 释放及续期时校验
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// fencing token, 同一 key 每次获取递增, 写入受保护的资源时携带, 资源拒绝小于已见过的值
+// 仅单个配置段时提供, Redlock 时返回 ErrNoFence
+func (l *Lock) Fence() (int64, error) {
+	if len(l.locker.handles) > 1 {
+		return 0, ErrNoFence
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fence, nil
+}
+
+// 锁的有效期截止时间
+func (l *Lock) Until() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.until
+}
+
+// 自动续期确认失去锁时关闭
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// 续期为 ttl, 锁已过期或被其他持有者获取时返回 ErrNotHeld
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	start := time.Now()
+	n, err := l.run(ctx, refreshScript, ttl, func(res int64) bool { return res == 1 })
+	if n >= l.locker.quorum {
+		if until := l.validUntil(start, ttl); until.After(time.Now()) {
+			l.mu.Lock()
+			l.until = until
+			l.mu.Unlock()
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ErrNotHeld
+}
+
+// 停止自动续期并释放锁, 锁已过期或被其他持有者获取时返回 ErrNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	<-l.released
+	n, err := l.run(ctx, releaseScript, 0, func(res int64) bool { return res == 1 })
+	if err != nil {
+		return err
+	}
+	if n < l.locker.quorum {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) obtain(ctx context.Context) (bool, error) {
+	start := time.Now()
+	var fence int64
+	var mu sync.Mutex
+	script := obtainScript
+	if len(l.locker.handles) > 1 {
+		script = acquireScript
+	}
+	n, err := l.run(ctx, script, l.ttl, func(res int64) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if res > fence {
+			fence = res
+		}
+		return res > 0
+	})
+	if until := l.validUntil(start, l.ttl); n >= l.locker.quorum && until.After(time.Now()) {
+		l.mu.Lock()
+		l.fence, l.until = fence, until
+		l.mu.Unlock()
+		return true, nil
+	}
+	if n > 0 {
+		// 未达到多数, 释放已获取的部分, 不受 ctx 取消影响
+		release, cancel := context.WithTimeout(context.Background(), l.ttl)
+		l.run(release, releaseScript, 0, func(int64) bool { return true })
+		cancel()
+	}
+	return false, err
+}
+
+// 扣除获取耗时及时钟漂移后的有效期
+func (l *Lock) validUntil(start time.Time, ttl time.Duration) time.Time {
+	drift := time.Duration(float64(ttl)*clockDriftFactor) + 2*time.Millisecond
+	return start.Add(ttl - drift)
+}
+
+// 在所有配置段上并发执行脚本, 返回 ok 的数量及第一个错误
+func (l *Lock) run(ctx context.Context, script *redis.Script, ttl time.Duration, ok func(res int64) bool) (int, error) {
+	handles := l.locker.handles
+	oks := make([]bool, len(handles))
+	errs := make([]error, len(handles))
+	var wg sync.WaitGroup
+	for i, handle := range handles {
+		wg.Add(1)
+		go func(i int, handle string) {
+			defer wg.Done()
+			client, err := redisconfig.Get(handle)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			keys := []string{l.key, l.fenceKey}
+			if script != obtainScript {
+				keys = keys[:1]
+			}
+			res, err := script.Run(ctx, client, keys, l.token, ttl.Milliseconds()).Int64()
+			if err != nil {
+				errs[i] = fmt.Errorf("redislock [%s] %s: %w", handle, l.key, err)
+				return
+			}
+			oks[i] = ok(res)
+		}(i, handle)
+	}
+	wg.Wait()
+	n := 0
+	var err error
+	for i := range handles {
+		if oks[i] {
+			n++
+		}
+		if err == nil {
+			err = errs[i]
+		}
+	}
+	return n, err
+}
+
+// 每 ttl/3 续期, 确认失去锁或超过有效期时关闭 lost
+func (l *Lock) keepAlive() {
+	defer close(l.released)
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.Refresh(ctx, l.ttl)
+		cancel()
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrNotHeld) || !l.Until().After(time.Now()) {
+			log.Logger.Errorf("redislock %s lost: %s", l.key, err.Error())
+			close(l.lost)
+			return
+		}
+		log.Logger.Warnf("redislock %s refresh err:%s", l.key, err.Error())
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("redislock: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
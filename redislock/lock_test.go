@@ -0,0 +1,186 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zhouchang2017/toolkit/config/redisconfig"
+)
+
+// 初始化指向测试 redis 的配置段
+func setup(t *testing.T, servers map[string]*miniredis.Miniredis) func() {
+	c := redisconfig.Configs{}
+	for name, r := range servers {
+		c[name] = &redisconfig.Config{Addr: r.Addr(), DialTimeout: 100 * time.Millisecond, MaxRetries: -1, HealthCheckInterval: -1}
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	return func() {
+		c.Close()
+	}
+}
+
+func TestLocker_Lock(t *testing.T) {
+	r := miniredis.RunT(t)
+	defer setup(t, map[string]*miniredis.Miniredis{"lock": r})()
+	ctx := context.Background()
+	locker := New("lock", &Options{Prefix: "lock:"})
+
+	lock, err := locker.Lock(ctx, "order", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if fence, err := lock.Fence(); lock.Key() != "lock:{order}" || fence != 1 || err != nil {
+		t.Errorf("Key() = %s, Fence() = %d, %v", lock.Key(), fence, err)
+	}
+	if _, err := locker.Lock(ctx, "order", time.Minute); !errors.Is(err, ErrNotObtained) {
+		t.Errorf("Lock() error = %v, want ErrNotObtained", err)
+	}
+	if err := lock.Refresh(ctx, time.Minute); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("second Unlock() error = %v, want ErrNotHeld", err)
+	}
+
+	lock, err = locker.Lock(ctx, "order", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if fence, _ := lock.Fence(); fence != 2 {
+		t.Errorf("Fence() = %d, want 2", fence)
+	}
+	// 锁过期后被其他持有者获取, 不能释放及续期
+	r.Set(lock.Key(), "other")
+	if err := lock.Refresh(ctx, time.Minute); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Refresh() error = %v, want ErrNotHeld", err)
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Unlock() error = %v, want ErrNotHeld", err)
+	}
+	if v, _ := r.Get(lock.Key()); v != "other" {
+		t.Errorf("Unlock() released a lock held by other: %s", v)
+	}
+}
+
+func TestLocker_Retry(t *testing.T) {
+	r := miniredis.RunT(t)
+	defer setup(t, map[string]*miniredis.Miniredis{"lock": r})()
+	ctx := context.Background()
+
+	held, err := New("lock", nil).Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.Unlock(ctx)
+	}()
+	locker := New("lock", &Options{Retry: LimitRetry(LinearBackoff(10*time.Millisecond), 50)})
+	lock, err := locker.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() with retry error = %v", err)
+	}
+	defer lock.Unlock(ctx)
+
+	timeout, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(timeout, "job", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestLock_AutoRefresh(t *testing.T) {
+	r := miniredis.RunT(t)
+	defer setup(t, map[string]*miniredis.Miniredis{"lock": r})()
+	ctx := context.Background()
+
+	lock, err := New("lock", &Options{AutoRefresh: true}).Lock(ctx, "job", 90*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	// miniredis 不随时间淘汰 key, 按经过的时间快进
+	for i := 0; i < 10; i++ {
+		time.Sleep(30 * time.Millisecond)
+		r.FastForward(30 * time.Millisecond)
+	}
+	select {
+	case <-lock.Lost():
+		t.Fatal("lock lost while refreshing")
+	default:
+	}
+	if !r.Exists(lock.Key()) {
+		t.Fatal("lock expired while refreshing")
+	}
+
+	r.Set(lock.Key(), "other")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost() not closed after lock taken by other")
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Unlock() error = %v, want ErrNotHeld", err)
+	}
+}
+
+func TestLocker_Redlock(t *testing.T) {
+	a, b, c := miniredis.RunT(t), miniredis.RunT(t), miniredis.RunT(t)
+	defer setup(t, map[string]*miniredis.Miniredis{"a": a, "b": b, "c": c})()
+	ctx := context.Background()
+	locker := NewRedlock([]string{"a", "b", "c"}, nil)
+
+	// 少数节点被占用时仍可获取
+	c.Set("{job}", "other")
+	lock, err := locker.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if _, err := lock.Fence(); !errors.Is(err, ErrNoFence) {
+		t.Errorf("Fence() error = %v, want ErrNoFence", err)
+	}
+	if a.Exists("{job}:fence") {
+		t.Error("redlock should not keep a fence counter")
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+
+	// 多数节点被占用时获取失败, 并释放已获取的节点
+	b.Set("{job}", "other")
+	if _, err := locker.Lock(ctx, "job", time.Minute); !errors.Is(err, ErrNotObtained) {
+		t.Errorf("Lock() error = %v, want ErrNotObtained", err)
+	}
+	if a.Exists("{job}") {
+		t.Error("partial lock on a should be released")
+	}
+}
+
+func TestRetryStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy RetryStrategy
+		want     []time.Duration
+	}{
+		{"no retry", NoRetry(), []time.Duration{0}},
+		{"linear", LinearBackoff(time.Second), []time.Duration{time.Second, time.Second}},
+		{"exponential", ExponentialBackoff(time.Second, 5*time.Second), []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+		{"limit", LimitRetry(LinearBackoff(time.Second), 2), []time.Duration{time.Second, time.Second, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.strategy.NextBackoff(i + 1); got != want {
+					t.Errorf("NextBackoff(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package redislock
+
+import "time"
+
+// 获取锁失败后的重试策略, 返回第 attempt 次失败后的等待时间, 小于等于 0 时不再重试
+// 策略不保存状态, 可在多次获取间共享
+type RetryStrategy interface {
+	NextBackoff(attempt int) time.Duration
+}
+
+type retryFunc func(attempt int) time.Duration
+
+func (f retryFunc) NextBackoff(attempt int) time.Duration {
+	return f(attempt)
+}
+
+// 不重试, 默认
+func NoRetry() RetryStrategy {
+	return retryFunc(func(int) time.Duration { return 0 })
+}
+
+// 固定间隔重试, 直到成功或 ctx 结束
+func LinearBackoff(backoff time.Duration) RetryStrategy {
+	return retryFunc(func(int) time.Duration { return backoff })
+}
+
+// 从 min 开始每次翻倍, 最大为 max, 直到成功或 ctx 结束
+func ExponentialBackoff(min, max time.Duration) RetryStrategy {
+	return retryFunc(func(attempt int) time.Duration {
+		backoff := min
+		for i := 1; i < attempt && backoff < max; i++ {
+			backoff *= 2
+		}
+		if backoff > max {
+			return max
+		}
+		return backoff
+	})
+}
+
+// 最多重试 max 次
+func LimitRetry(s RetryStrategy, max int) RetryStrategy {
+	return retryFunc(func(attempt int) time.Duration {
+		if attempt > max {
+			return 0
+		}
+		return s.NextBackoff(attempt)
+	})
+}
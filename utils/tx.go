@@ -1,9 +1,37 @@
 package utils
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
 
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+)
+
+// 在事务中执行 handle, 见 TransactionContext
 func Transaction(db *sql.DB, handle func(tx *sql.Tx) error) (err error) {
-	tx, err := db.Begin()
+	return TransactionContext(context.Background(), db, handle)
+}
+
+// 在事务中执行 handle, 整个事务经过连接的熔断及并发隔离,
+// 遇到死锁等临时错误时按连接的重试策略回滚后重新执行整个 handle, handle 需可重复执行
+// 提交成功后执行 mysqlconfig.AfterCommit 注册的函数
+func TransactionContext(ctx context.Context, db *sql.DB, handle func(tx *sql.Tx) error) error {
+	name, ok := mysqlconfig.NameOf(db)
+	if !ok {
+		return transaction(ctx, db, handle)
+	}
+	return mysqlconfig.Retry(ctx, name, func() (err error) {
+		done, err := mysqlconfig.Acquire(ctx, name)
+		if err != nil {
+			return err
+		}
+		defer func() { done(err) }()
+		return transaction(ctx, db, handle)
+	})
+}
+
+func transaction(ctx context.Context, db *sql.DB, handle func(tx *sql.Tx) error) (err error) {
+	tx, err := mysqlconfig.BeginTx(ctx, db, nil)
 	if err != nil {
 		return err
 	}
@@ -12,7 +40,7 @@ func Transaction(db *sql.DB, handle func(tx *sql.Tx) error) (err error) {
 			tx.Rollback()
 		}
 	}()
-	if err = handle(tx); err != nil {
+	if err = handle(tx.Tx); err != nil {
 		return err
 	}
 	return tx.Commit()
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhouchang2017/toolkit/config/mysqlconfig"
+	"github.com/zhouchang2017/toolkit/internal/fakesql"
+)
+
+var fake = &fakesql.Driver{}
+
+func init() {
+	sql.Register("toolkit-utils-fake", fake)
+	mysqlconfig.RegisterDriver("toolkit-utils-fake", mysqlconfig.DialectMySQL, "", func(c mysqlconfig.Config) string {
+		return c.Host
+	})
+}
+
+// 提交前连接断开时按 bad_conn 重新执行整个事务
+func TestTransactionContext_badConn(t *testing.T) {
+	tests := []struct {
+		name      string
+		badConn   bool
+		wantErr   error
+		wantCalls int
+		wantHooks int
+	}{
+		{"enabled", true, nil, 2, 1},
+		{"disabled", false, driver.ErrBadConn, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mysqlconfig.Configs{"tx": mysqlconfig.Config{
+				Driver:      "toolkit-utils-fake",
+				Host:        "tx",
+				RetryPolicy: mysqlconfig.RetryPolicy{MaxAttempts: 3, BadConn: tt.badConn},
+			}}
+			if err := c.Init(); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			defer c.Close()
+			defer fake.Reset()
+
+			var mu sync.Mutex
+			failed := false
+			fake.Handle(func(dsn, query string, args []driver.NamedValue) (*fakesql.Result, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if strings.HasPrefix(query, "UPDATE") && !failed {
+					failed = true
+					return nil, driver.ErrBadConn
+				}
+				return &fakesql.Result{RowsAffected: 1}, nil
+			})
+			db, err := mysqlconfig.Get("tx")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls, committed := 0, 0
+			err = TransactionContext(context.Background(), db, func(tx *sql.Tx) error {
+				calls++
+				mysqlconfig.AfterCommit(tx, func() { committed++ })
+				_, err := tx.Exec("UPDATE users SET name = 'tom'")
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransactionContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handle called %d times, want %d", calls, tt.wantCalls)
+			}
+			if committed != tt.wantHooks {
+				t.Errorf("after commit hooks ran %d times, want %d", committed, tt.wantHooks)
+			}
+		})
+	}
+}